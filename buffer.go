@@ -0,0 +1,140 @@
+package oceanlog
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// DebugBuffer holds the Trace and Debug records of one request that are below the logger level.
+// The records are written, in order, when the request fails and dropped when it succeeds.
+type DebugBuffer struct {
+	maxRecords int
+	maxBytes   int
+
+	mu      sync.Mutex
+	records []bufferedRecord
+	size    int
+	dropped int
+}
+
+type bufferedRecord struct {
+	// l and ctx are the logger and the context of the record, the drop notice is written through them
+	l   *DefaultLogger
+	ctx context.Context
+	out io.Writer
+	p   []byte
+}
+
+type debugBufferKey struct{}
+
+// Default limits of WithDebugBuffer.
+const (
+	DefaultDebugBufferRecords = 256
+	DefaultDebugBufferBytes   = 256 << 10
+)
+
+// WithDebugBuffer returns a context that buffers the Trace and Debug records logged through
+// the Ctx*f methods. maxRecords and maxBytes bound the buffer, the oldest records are dropped first.
+// Zero limits default to DefaultDebugBufferRecords and DefaultDebugBufferBytes.
+func WithDebugBuffer(ctx context.Context, maxRecords, maxBytes int) context.Context {
+	if maxRecords <= 0 {
+		maxRecords = DefaultDebugBufferRecords
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultDebugBufferBytes
+	}
+	return context.WithValue(ctx, debugBufferKey{}, &DebugBuffer{maxRecords: maxRecords, maxBytes: maxBytes})
+}
+
+// DebugBufferFromContext returns the buffer attached by WithDebugBuffer, or nil.
+func DebugBufferFromContext(ctx context.Context) *DebugBuffer {
+	if ctx == nil {
+		return nil
+	}
+	b, _ := ctx.Value(debugBufferKey{}).(*DebugBuffer)
+	return b
+}
+
+// FlushDebugBuffer writes the records buffered in ctx, e.g. when a request failed.
+func FlushDebugBuffer(ctx context.Context) {
+	if b := DebugBufferFromContext(ctx); b != nil {
+		b.Flush()
+	}
+}
+
+// DiscardDebugBuffer drops the records buffered in ctx, e.g. when a request succeeded.
+func DiscardDebugBuffer(ctx context.Context) {
+	if b := DebugBufferFromContext(ctx); b != nil {
+		b.Discard()
+	}
+}
+
+// Len returns the number of buffered records.
+func (b *DebugBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.records)
+}
+
+// Flush writes the buffered records to the outputs they were logged for and empties the buffer.
+func (b *DebugBuffer) Flush() {
+	b.mu.Lock()
+	records, dropped := b.records, b.dropped
+	b.records, b.size, b.dropped = nil, 0, 0
+	b.mu.Unlock()
+
+	if dropped > 0 && len(records) > 0 {
+		r := records[0]
+		zl := r.l.Unwrap()
+		r.l.newEvent(&zl, LevelWarn, r.ctx, nil).
+			Int("dropped", dropped).
+			Msgf("debug buffer dropped %d records", dropped)
+	}
+	for _, r := range records {
+		_, _ = r.out.Write(r.p)
+	}
+}
+
+// Discard empties the buffer.
+func (b *DebugBuffer) Discard() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.records, b.size, b.dropped = nil, 0, 0
+}
+
+func (b *DebugBuffer) add(r bufferedRecord) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(r.p) > b.maxBytes {
+		b.dropped++
+		return
+	}
+	r.p = append([]byte(nil), r.p...)
+	b.records = append(b.records, r)
+	b.size += len(r.p)
+	for len(b.records) > b.maxRecords || b.size > b.maxBytes {
+		b.size -= len(b.records[0].p)
+		b.records[0] = bufferedRecord{}
+		b.records = b.records[1:]
+		b.dropped++
+	}
+}
+
+// writer returns an io.Writer buffering the records of l logged with ctx, that are later flushed to the output of l.
+func (b *DebugBuffer) writer(l *DefaultLogger, ctx context.Context) io.Writer {
+	return bufferWriter{b: b, l: l, ctx: ctx, out: l.writer()}
+}
+
+type bufferWriter struct {
+	b   *DebugBuffer
+	l   *DefaultLogger
+	ctx context.Context
+	out io.Writer
+}
+
+func (w bufferWriter) Write(p []byte) (int, error) {
+	w.b.add(bufferedRecord{l: w.l, ctx: w.ctx, out: w.out, p: p})
+	return len(p), nil
+}
@@ -0,0 +1,116 @@
+package oceanlog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugBuffer_flushOnError(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b), WithLevel(LevelInfo), WithoutCaller())
+	ctx := WithDebugBuffer(context.Background(), 0, 0)
+
+	l.CtxDebugf(ctx, "step %d", 1)
+	l.CtxInfof(ctx, "info")
+	l.CtxDebugf(ctx, "step %d", 2)
+	assert.Equal(t, []string{`{"level":"info","message":"info"}`}, b.Lines())
+
+	l.CtxErrorf(ctx, "failed")
+	assert.Equal(t, []string{
+		`{"level":"info","message":"info"}`,
+		`{"level":"debug","message":"step 1"}`,
+		`{"level":"debug","message":"step 2"}`,
+		`{"level":"error","message":"failed"}`,
+	}, b.Lines())
+	assert.Equal(t, 0, DebugBufferFromContext(ctx).Len())
+}
+
+func TestDebugBuffer_discard(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b), WithLevel(LevelInfo))
+	ctx := WithDebugBuffer(context.Background(), 0, 0)
+
+	l.CtxDebugf(ctx, "step")
+	DiscardDebugBuffer(ctx)
+	FlushDebugBuffer(ctx)
+
+	assert.Equal(t, []string{""}, b.Lines())
+}
+
+func TestDebugBuffer_levelEnabled(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b), WithLevel(LevelDebug), WithoutCaller())
+	ctx := WithDebugBuffer(context.Background(), 0, 0)
+
+	l.CtxDebugf(ctx, "step")
+
+	assert.Equal(t, []string{`{"level":"debug","message":"step"}`}, b.Lines())
+	assert.Equal(t, 0, DebugBufferFromContext(ctx).Len())
+}
+
+func TestDebugBuffer_limits(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b), WithLevel(LevelInfo), WithoutCaller())
+	ctx := WithDebugBuffer(context.Background(), 2, 0)
+
+	for i := 0; i < 5; i++ {
+		l.CtxDebugf(ctx, "step %d", i)
+	}
+	assert.Equal(t, 2, DebugBufferFromContext(ctx).Len())
+
+	FlushDebugBuffer(ctx)
+	assert.Equal(t, []string{
+		`{"level":"warn","dropped":3,"message":"debug buffer dropped 3 records"}`,
+		`{"level":"debug","message":"step 3"}`,
+		`{"level":"debug","message":"step 4"}`,
+	}, b.Lines())
+}
+
+func TestDebugBuffer_dropNotice(t *testing.T) {
+	b := &syncBuffer{}
+	now := ClockFunc(func() time.Time { return time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC) })
+	l := New(WithOutput(b), WithLevel(LevelInfo), WithClock(now), WithFormattedTimestamp(time.RFC3339),
+		WithRedactor(MustNewRedactor(RedactConf{Builtin: []string{RedactEmail}}))).Named("api")
+	ctx := ContextWithFields(WithDebugBuffer(context.Background(), 1, 0), "user", "bob@example.com")
+
+	l.CtxDebugf(ctx, "step 1")
+	l.CtxDebugf(ctx, "step 2")
+	l.CtxErrorf(ctx, "failed")
+
+	// the notice goes through the logger of the records, like they do
+	lines := b.Lines()
+	if assert.Len(t, lines, 3) {
+		assert.Regexp(t, `^\{"level":"warn","logger":"api","dropped":1,"time":"2024-05-06T07:08:09Z","caller":"buffer_test.go:\d+",`+
+			`"user":"\*\*\*\*\*\*","message":"debug buffer dropped 1 records"\}$`, lines[0])
+		assert.Contains(t, lines[1], `"message":"step 2"`)
+		assert.Contains(t, lines[2], `"message":"failed"`)
+	}
+}
+
+func TestDebugBufferMiddleware(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b), WithLevel(LevelInfo), WithoutCaller())
+
+	engine := route.NewEngine(config.NewOptions(nil))
+	engine.Use(DebugBufferMiddleware(0, 0))
+	engine.GET("/ok", func(ctx context.Context, c *app.RequestContext) {
+		l.CtxDebugf(ctx, "ok handler")
+		c.String(200, "ok")
+	})
+	engine.GET("/fail", func(ctx context.Context, c *app.RequestContext) {
+		l.CtxDebugf(ctx, "fail handler")
+		c.String(503, "unavailable")
+	})
+
+	ut.PerformRequest(engine, "GET", "/ok", nil)
+	ut.PerformRequest(engine, "GET", "/fail", nil)
+
+	assert.Equal(t, []string{`{"level":"debug","message":"fail handler"}`}, b.Lines())
+}
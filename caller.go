@@ -0,0 +1,174 @@
+package oceanlog
+
+import (
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/rs/zerolog"
+)
+
+// CallerFormat is the format of the caller field, see WithCallerFormat.
+type CallerFormat int
+
+const (
+	// CallerBasename logs the file name and line, e.g. "server.go:42".
+	CallerBasename CallerFormat = iota
+	// CallerModuleRelative logs the file path relative to the main module and line,
+	// e.g. "internal/server/server.go:42". Files of other modules keep their package path.
+	CallerModuleRelative
+	// CallerFullPath logs the file path and line, e.g. "/src/app/internal/server/server.go:42".
+	CallerFullPath
+	// CallerFunction logs the function name and line, e.g. "server.(*Server).Handle:42".
+	CallerFunction
+)
+
+// callerAuto makes callerHook find the caller itself, skipping the frames of wrappers.
+const callerAuto = -1
+
+var (
+	hlogPkg = reflect.TypeOf(hlog.Level(0)).PkgPath() + "."
+	// oceanlogModule is the prefix of the subpackages of this module, such as dblog
+	oceanlogModule = reflect.TypeOf(DefaultLogger{}).PkgPath() + "/"
+
+	// dbWrappers are the packages calling the loggers of dblog
+	dbWrappers = []string{"database/sql.", "gorm.io/"}
+
+	mainModule = func() string {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			return info.Main.Path
+		}
+		return ""
+	}()
+)
+
+// callerConf is the per-logger caller configuration.
+type callerConf struct {
+	// skip is the zerolog skip frame count, or callerAuto
+	skip   int
+	format CallerFormat
+	// wrappers are the package prefixes skipped in addition to zerolog, hlog and this package
+	wrappers []string
+}
+
+// callerHook adds the caller field like zerolog's caller hook, formatted per logger.
+type callerHook struct {
+	conf callerConf
+}
+
+// Run implements zerolog.Hook.
+func (h callerHook) Run(e *zerolog.Event, level zerolog.Level, message string) {
+	if level == zerolog.Disabled {
+		return
+	}
+	var frame runtime.Frame
+	if h.conf.skip == callerAuto {
+		frame = h.caller()
+	} else {
+		// zerolog skips from Event.caller, one frame below this one
+		pc, file, line, ok := runtime.Caller(h.conf.skip + 1)
+		if !ok {
+			return
+		}
+		frame = runtime.Frame{PC: pc, File: file, Line: line}
+		if fn := runtime.FuncForPC(pc); fn != nil {
+			frame.Function = fn.Name()
+		}
+	}
+	if frame.File == "" {
+		return
+	}
+	e.Str(zerolog.CallerFieldName, formatCaller(frame, h.conf.format))
+}
+
+// caller returns the first frame outside zerolog, hlog, the runtime, this module, the packages calling
+// dblog and the configured wrappers.
+func (h callerHook) caller() runtime.Frame {
+	var pcs [32]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		if !h.wrapper(f) || !more {
+			return f
+		}
+	}
+}
+
+func (h callerHook) wrapper(f runtime.Frame) bool {
+	for _, prefix := range h.conf.wrappers {
+		if strings.HasPrefix(f.Function, prefix) {
+			return true
+		}
+	}
+	for _, prefix := range dbWrappers {
+		if strings.HasPrefix(f.Function, prefix) {
+			return true
+		}
+	}
+	return strings.HasPrefix(f.Function, zerologPkg) || strings.HasPrefix(f.Function, hlogPkg) ||
+		strings.HasPrefix(f.Function, "runtime.") || internalFrame(f.Function, f.File)
+}
+
+// internalFrame reports whether the function fn of file belongs to this module, subpackages included,
+// outside of its tests.
+func internalFrame(fn, file string) bool {
+	return (strings.HasPrefix(fn, oceanlogPkg) || strings.HasPrefix(fn, oceanlogModule)) &&
+		!strings.HasSuffix(file, "_test.go")
+}
+
+func formatCaller(f runtime.Frame, format CallerFormat) string {
+	line := strconv.Itoa(f.Line)
+	switch format {
+	case CallerFullPath:
+		return f.File + ":" + line
+	case CallerFunction:
+		fn := f.Function
+		if i := strings.LastIndex(fn, "/"); i >= 0 {
+			fn = fn[i+1:]
+		}
+		return fn + ":" + line
+	case CallerModuleRelative:
+		return moduleRelative(f) + ":" + line
+	default:
+		return basename(f.File) + ":" + line
+	}
+}
+
+// moduleRelative returns the file of f relative to the main module, derived from its package path.
+func moduleRelative(f runtime.Frame) string {
+	pkg := packagePath(f.Function)
+	if pkg == "" {
+		return f.File
+	}
+	switch {
+	case mainModule != "" && pkg == mainModule:
+		pkg = ""
+	case mainModule != "" && strings.HasPrefix(pkg, mainModule+"/"):
+		pkg = strings.TrimPrefix(pkg, mainModule+"/")
+	}
+	if pkg == "" || pkg == "main" {
+		return basename(f.File)
+	}
+	return pkg + "/" + basename(f.File)
+}
+
+// packagePath returns the package path of a function name such as "github.com/a/b.(*T).M".
+func packagePath(fn string) string {
+	slash := strings.LastIndex(fn, "/")
+	dot := strings.Index(fn[slash+1:], ".")
+	if dot < 0 {
+		return ""
+	}
+	return fn[:slash+1+dot]
+}
+
+func basename(file string) string {
+	if i := strings.LastIndexAny(file, `/\`); i >= 0 {
+		return file[i+1:]
+	}
+	return file
+}
@@ -0,0 +1,72 @@
+package oceanlog
+
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Clock tells the time of the records, see WithClock.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function such as time.Now to Clock.
+type ClockFunc func() time.Time
+
+// Now implements Clock.
+func (fn ClockFunc) Now() time.Time {
+	return fn()
+}
+
+// SystemClock is the default Clock.
+var SystemClock Clock = ClockFunc(time.Now)
+
+// Timestamp formats logging the time as a Unix epoch number instead of a string.
+const (
+	TimeFormatUnix      = zerolog.TimeFormatUnix
+	TimeFormatUnixMs    = zerolog.TimeFormatUnixMs
+	TimeFormatUnixMicro = zerolog.TimeFormatUnixMicro
+	TimeFormatUnixNano  = zerolog.TimeFormatUnixNano
+)
+
+// timestampConf is the per-logger timestamp configuration.
+type timestampConf struct {
+	format string
+	// loc is nil to keep the location of the clock
+	loc *time.Location
+}
+
+// timestampHook adds the time of clock to every record once conf is set. It is the first hook of
+// a logger, so that the time precedes the fields added by the other hooks.
+type timestampHook struct {
+	clock Clock
+	conf  *timestampConf
+}
+
+// Run implements zerolog.Hook.
+func (h *timestampHook) Run(e *zerolog.Event, level zerolog.Level, message string) {
+	if h.conf == nil || level == zerolog.Disabled {
+		return
+	}
+	h.conf.stamp(e, h.clock.Now())
+}
+
+// stamp adds the time field now to e.
+func (c *timestampConf) stamp(e *zerolog.Event, now time.Time) {
+	if c.loc != nil {
+		now = now.In(c.loc)
+	}
+	switch c.format {
+	case TimeFormatUnix:
+		e.Int64(zerolog.TimestampFieldName, now.Unix())
+	case TimeFormatUnixMs:
+		e.Int64(zerolog.TimestampFieldName, now.UnixMilli())
+	case TimeFormatUnixMicro:
+		e.Int64(zerolog.TimestampFieldName, now.UnixMicro())
+	case TimeFormatUnixNano:
+		e.Int64(zerolog.TimestampFieldName, now.UnixNano())
+	default:
+		e.Str(zerolog.TimestampFieldName, now.Format(c.format))
+	}
+}
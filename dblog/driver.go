@@ -0,0 +1,292 @@
+package dblog
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+)
+
+var (
+	_ driver.Driver             = (*wrappedDriver)(nil)
+	_ driver.DriverContext      = (*wrappedDriver)(nil)
+	_ driver.Connector          = (*wrappedConnector)(nil)
+	_ driver.Conn               = (*wrappedConn)(nil)
+	_ driver.ConnPrepareContext = (*wrappedConn)(nil)
+	_ driver.ConnBeginTx        = (*wrappedConn)(nil)
+	_ driver.ExecerContext      = (*wrappedConn)(nil)
+	_ driver.QueryerContext     = (*wrappedConn)(nil)
+	_ driver.Pinger             = (*wrappedConn)(nil)
+	_ driver.SessionResetter    = (*wrappedConn)(nil)
+	_ driver.Validator          = (*wrappedConn)(nil)
+	_ driver.NamedValueChecker  = (*wrappedConn)(nil)
+	_ driver.Stmt               = (*wrappedStmt)(nil)
+	_ driver.StmtExecContext    = (*wrappedStmt)(nil)
+	_ driver.StmtQueryContext   = (*wrappedStmt)(nil)
+)
+
+// Register wraps d with Wrap and registers it with database/sql under name.
+func Register(name string, d driver.Driver, options ...Option) {
+	sql.Register(name, Wrap(d, options...))
+}
+
+// Wrap returns a driver.Driver that logs every statement executed through d.
+func Wrap(d driver.Driver, options ...Option) driver.Driver {
+	return &wrappedDriver{parent: d, opts: newOptions(options)}
+}
+
+// WrapConnector returns a driver.Connector for sql.OpenDB that logs every statement executed through c.
+func WrapConnector(c driver.Connector, options ...Option) driver.Connector {
+	opts := newOptions(options)
+	return &wrappedConnector{parent: c, driver: &wrappedDriver{parent: c.Driver(), opts: opts}, opts: opts}
+}
+
+type wrappedDriver struct {
+	parent driver.Driver
+	opts   *Options
+}
+
+func (d *wrappedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.parent.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedConn{parent: conn, opts: d.opts}, nil
+}
+
+func (d *wrappedDriver) OpenConnector(name string) (driver.Connector, error) {
+	if dc, ok := d.parent.(driver.DriverContext); ok {
+		c, err := dc.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return &wrappedConnector{parent: c, driver: d, opts: d.opts}, nil
+	}
+	return &dsnConnector{name: name, driver: d}, nil
+}
+
+type wrappedConnector struct {
+	parent driver.Connector
+	driver *wrappedDriver
+	opts   *Options
+}
+
+func (c *wrappedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.parent.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedConn{parent: conn, opts: c.opts}, nil
+}
+
+func (c *wrappedConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// dsnConnector is used when the parent driver does not implement driver.DriverContext.
+type dsnConnector struct {
+	name   string
+	driver *wrappedDriver
+}
+
+func (c *dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.name)
+}
+
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type wrappedConn struct {
+	parent driver.Conn
+	opts   *Options
+}
+
+func (c *wrappedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *wrappedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		stmt driver.Stmt
+		err  error
+	)
+	if pc, ok := c.parent.(driver.ConnPrepareContext); ok {
+		stmt, err = pc.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.parent.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedStmt{parent: stmt, query: query, opts: c.opts}, nil
+}
+
+func (c *wrappedConn) Close() error {
+	return c.parent.Close()
+}
+
+func (c *wrappedConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *wrappedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if bc, ok := c.parent.(driver.ConnBeginTx); ok {
+		return bc.BeginTx(ctx, opts)
+	}
+	return c.parent.Begin()
+}
+
+// ExecContext returns driver.ErrSkip when the parent driver cannot execute directly,
+// database/sql then falls back to a prepared statement which is logged by wrappedStmt.
+func (c *wrappedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := c.parent.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	begin := time.Now()
+	res, err := ec.ExecContext(ctx, query, args)
+	if errors.Is(err, driver.ErrSkip) {
+		return res, err
+	}
+	c.opts.logExec(ctx, begin, query, args, res, err)
+	return res, err
+}
+
+// QueryContext behaves like ExecContext regarding driver.ErrSkip.
+func (c *wrappedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := c.parent.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	begin := time.Now()
+	rows, err := qc.QueryContext(ctx, query, args)
+	if errors.Is(err, driver.ErrSkip) {
+		return rows, err
+	}
+	c.opts.logQuery(ctx, begin, query, args, err)
+	return rows, err
+}
+
+func (c *wrappedConn) Ping(ctx context.Context) error {
+	if p, ok := c.parent.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *wrappedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.parent.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *wrappedConn) IsValid() bool {
+	if v, ok := c.parent.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *wrappedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := c.parent.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type wrappedStmt struct {
+	parent driver.Stmt
+	query  string
+	opts   *Options
+}
+
+func (s *wrappedStmt) Close() error {
+	return s.parent.Close()
+}
+
+func (s *wrappedStmt) NumInput() int {
+	return s.parent.NumInput()
+}
+
+func (s *wrappedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), valuesToNamed(args))
+}
+
+func (s *wrappedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), valuesToNamed(args))
+}
+
+func (s *wrappedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	var (
+		res   driver.Result
+		err   error
+		begin = time.Now()
+	)
+	if ec, ok := s.parent.(driver.StmtExecContext); ok {
+		res, err = ec.ExecContext(ctx, args)
+	} else {
+		res, err = s.parent.Exec(namedToValues(args))
+	}
+	s.opts.logExec(ctx, begin, s.query, args, res, err)
+	return res, err
+}
+
+func (s *wrappedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	var (
+		rows  driver.Rows
+		err   error
+		begin = time.Now()
+	)
+	if qc, ok := s.parent.(driver.StmtQueryContext); ok {
+		rows, err = qc.QueryContext(ctx, args)
+	} else {
+		rows, err = s.parent.Query(namedToValues(args))
+	}
+	s.opts.logQuery(ctx, begin, s.query, args, err)
+	return rows, err
+}
+
+func (o *Options) logExec(ctx context.Context, begin time.Time, query string, args []driver.NamedValue, res driver.Result, err error) {
+	rows := int64(-1)
+	if err == nil && res != nil {
+		if n, rerr := res.RowsAffected(); rerr == nil {
+			rows = n
+		}
+	}
+	o.logDriver(ctx, begin, query, args, rows, err)
+}
+
+func (o *Options) logQuery(ctx context.Context, begin time.Time, query string, args []driver.NamedValue, err error) {
+	o.logDriver(ctx, begin, query, args, -1, err)
+}
+
+func (o *Options) logDriver(ctx context.Context, begin time.Time, query string, args []driver.NamedValue, rows int64, err error) {
+	if err != nil && o.ignoreNoRows && errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	elapsed := time.Since(begin)
+	values := make([]interface{}, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	logStatement(o, ctx, o.levelOf(elapsed, err), "", elapsed, query, o.args(query, values), rows, err)
+}
+
+func valuesToNamed(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
+
+func namedToValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	return values
+}
@@ -0,0 +1,200 @@
+package dblog
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/v-mars/oceanlog"
+)
+
+// fakeDriver is an in-memory driver storing a single list of names.
+// "INSERT" appends its argument, "SELECT" returns every name and "FAIL" returns an error.
+type fakeDriver struct {
+	mu    sync.Mutex
+	names []string
+	delay time.Duration
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) {
+	return &fakeConn{d: d}, nil
+}
+
+type fakeConn struct {
+	d *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type fakeStmt struct {
+	c     *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return strings.Count(s.query, "?")
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	time.Sleep(s.c.d.delay)
+	if strings.HasPrefix(s.query, "FAIL") {
+		return nil, errors.New("boom")
+	}
+	s.c.d.mu.Lock()
+	defer s.c.d.mu.Unlock()
+	s.c.d.names = append(s.c.d.names, args[0].(string))
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.c.d.mu.Lock()
+	defer s.c.d.mu.Unlock()
+	return &fakeRows{names: append([]string(nil), s.c.d.names...)}, nil
+}
+
+type fakeRows struct {
+	names []string
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"name"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.names) == 0 {
+		return io.EOF
+	}
+	dest[0], r.names = r.names[0], r.names[1:]
+	return nil
+}
+
+type Log struct {
+	Level     string `json:"level"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+	Caller    string `json:"caller"`
+}
+
+func decodeLogs(t *testing.T, b *bytes.Buffer) []Log {
+	var logs []Log
+	dec := json.NewDecoder(b)
+	for dec.More() {
+		var l Log
+		assert.NoError(t, dec.Decode(&l))
+		logs = append(logs, l)
+	}
+	return logs
+}
+
+func openDB(t *testing.T, d *fakeDriver, options ...Option) *sql.DB {
+	c, err := Wrap(d, options...).(driver.DriverContext).OpenConnector("")
+	assert.NoError(t, err)
+	db := sql.OpenDB(c)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestWrap(t *testing.T) {
+	b := &bytes.Buffer{}
+	db := openDB(t, &fakeDriver{}, WithLogger(oceanlog.New(oceanlog.WithOutput(b))))
+	ctx := oceanlog.ContextWithRequestID(context.Background(), "req-1")
+
+	res, err := db.ExecContext(ctx, "INSERT INTO users (name) VALUES (?)", "alice")
+	assert.NoError(t, err)
+	n, _ := res.RowsAffected()
+	assert.Equal(t, int64(1), n)
+
+	rows, err := db.QueryContext(ctx, "SELECT name FROM users")
+	assert.NoError(t, err)
+	assert.NoError(t, rows.Close())
+
+	_, err = db.ExecContext(ctx, "FAIL ?", "x")
+	assert.Error(t, err)
+
+	logs := decodeLogs(t, b)
+	assert.Len(t, logs, 3)
+
+	assert.Equal(t, "debug", logs[0].Level)
+	assert.Equal(t, "req-1", logs[0].RequestID)
+	assert.Contains(t, logs[0].Message, "[rows:1] INSERT INTO users (name) VALUES (?) args=[alice]")
+
+	assert.Equal(t, "debug", logs[1].Level)
+	assert.Contains(t, logs[1].Message, "[rows:-] SELECT name FROM users")
+
+	assert.Equal(t, "error", logs[2].Level)
+	assert.Contains(t, logs[2].Message, "error: boom")
+}
+
+func TestWrap_caller(t *testing.T) {
+	b := &bytes.Buffer{}
+	db := openDB(t, &fakeDriver{}, WithLogger(oceanlog.New(oceanlog.WithOutput(b), oceanlog.WithCaller())))
+
+	_, file, line, _ := runtime.Caller(0)
+	_, err := db.Exec("INSERT INTO users (name) VALUES (?)", "alice")
+	assert.NoError(t, err)
+
+	// the frames of dblog and database/sql are skipped
+	logs := decodeLogs(t, b)
+	if assert.Len(t, logs, 1) {
+		assert.Equal(t, filepath.Base(file)+":"+strconv.Itoa(line+1), logs[0].Caller)
+	}
+}
+
+func TestWrap_slowQuery(t *testing.T) {
+	b := &bytes.Buffer{}
+	db := openDB(t, &fakeDriver{delay: 5 * time.Millisecond},
+		WithLogger(oceanlog.New(oceanlog.WithOutput(b))),
+		WithSlowThreshold(time.Millisecond),
+	)
+
+	_, err := db.Exec("INSERT INTO users (name) VALUES (?)", "bob")
+	assert.NoError(t, err)
+
+	logs := decodeLogs(t, b)
+	assert.Len(t, logs, 1)
+	assert.Equal(t, "warn", logs[0].Level)
+	assert.True(t, strings.HasPrefix(logs[0].Message, "SLOW SQL >= 1ms "))
+}
+
+func TestWrap_redactedArgs(t *testing.T) {
+	b := &bytes.Buffer{}
+	db := openDB(t, &fakeDriver{}, WithLogger(oceanlog.New(oceanlog.WithOutput(b))), WithRedactedArgs())
+
+	_, err := db.Exec("INSERT INTO users (name) VALUES (?)", "secret")
+	assert.NoError(t, err)
+
+	logs := decodeLogs(t, b)
+	assert.Len(t, logs, 1)
+	assert.NotContains(t, logs[0].Message, "secret")
+	assert.Contains(t, logs[0].Message, "args=["+Redacted+"]")
+}
@@ -0,0 +1,87 @@
+package dblog
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/v-mars/oceanlog"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"gorm.io/gorm/utils"
+)
+
+var (
+	_ gormlogger.Interface = (*GormLogger)(nil)
+	_ gorm.ParamsFilter    = (*GormLogger)(nil)
+)
+
+// GormLogger is an implementation of gorm's logger.Interface backed by oceanlog.DefaultLogger.
+type GormLogger struct {
+	opts  *Options
+	level gormlogger.LogLevel
+}
+
+// NewGormLogger returns a GormLogger that logs every statement.
+// Use LogMode to narrow it down the way gorm's own logger does.
+func NewGormLogger(options ...Option) *GormLogger {
+	return &GormLogger{
+		opts:  newOptions(options),
+		level: gormlogger.Info,
+	}
+}
+
+// LogMode returns a copy of the logger with the given gorm log level.
+func (l *GormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	n := *l
+	n.level = level
+	return &n
+}
+
+// Info logs a message at info level.
+func (l *GormLogger) Info(ctx context.Context, format string, v ...interface{}) {
+	if l.level >= gormlogger.Info {
+		l.opts.log().CtxLogf(oceanlog.LevelInfo, ctx, format, v...)
+	}
+}
+
+// Warn logs a message at warn level.
+func (l *GormLogger) Warn(ctx context.Context, format string, v ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		l.opts.log().CtxLogf(oceanlog.LevelWarn, ctx, format, v...)
+	}
+}
+
+// Error logs a message at error level.
+func (l *GormLogger) Error(ctx context.Context, format string, v ...interface{}) {
+	if l.level >= gormlogger.Error {
+		l.opts.log().CtxLogf(oceanlog.LevelError, ctx, format, v...)
+	}
+}
+
+// Trace logs a finished statement with its duration, affected rows and error.
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+
+	if err != nil && l.opts.ignoreNoRows && errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	elapsed := time.Since(begin)
+	level := l.opts.levelOf(elapsed, err)
+	switch {
+	case level == oceanlog.LevelError && l.level < gormlogger.Error,
+		level == oceanlog.LevelWarn && l.level < gormlogger.Warn,
+		level < oceanlog.LevelWarn && l.level < gormlogger.Info:
+		return
+	}
+
+	sql, rows := fc()
+	logStatement(l.opts, ctx, level, utils.FileWithLineNum(), elapsed, sql, nil, rows, err)
+}
+
+// ParamsFilter redacts the statement arguments before gorm renders them into the SQL text.
+func (l *GormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, l.opts.args(sql, params)
+}
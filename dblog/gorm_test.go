@@ -0,0 +1,74 @@
+package dblog
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/v-mars/oceanlog"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestGormLogger_Trace(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := NewGormLogger(WithLogger(oceanlog.New(oceanlog.WithOutput(b))), WithSlowThreshold(time.Second))
+	ctx := oceanlog.ContextWithRequestID(context.Background(), "req-1")
+	fc := func() (string, int64) { return "SELECT * FROM users", 2 }
+
+	l.Trace(ctx, time.Now(), fc, nil)
+	l.Trace(ctx, time.Now().Add(-2*time.Second), fc, nil)
+	l.Trace(ctx, time.Now(), fc, gorm.ErrInvalidData)
+
+	logs := decodeLogs(t, b)
+	assert.Len(t, logs, 3)
+	assert.Equal(t, "debug", logs[0].Level)
+	assert.Equal(t, "req-1", logs[0].RequestID)
+	assert.Contains(t, logs[0].Message, "gorm_test.go:")
+	assert.Contains(t, logs[0].Message, "[rows:2] SELECT * FROM users")
+	assert.Equal(t, "warn", logs[1].Level)
+	assert.Contains(t, logs[1].Message, "SLOW SQL >= 1s")
+	assert.Equal(t, "error", logs[2].Level)
+	assert.Contains(t, logs[2].Message, "error: unsupported data")
+}
+
+func TestGormLogger_LogMode(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := NewGormLogger(WithLogger(oceanlog.New(oceanlog.WithOutput(b))), WithIgnoreRecordNotFound())
+	fc := func() (string, int64) { return "SELECT * FROM users", 0 }
+
+	l.LogMode(gormlogger.Silent).Trace(context.Background(), time.Now(), fc, gorm.ErrInvalidData)
+	l.LogMode(gormlogger.Error).Trace(context.Background(), time.Now(), fc, nil)
+	l.LogMode(gormlogger.Error).Info(context.Background(), "info %d", 1)
+	assert.Empty(t, b.String())
+
+	l.Trace(context.Background(), time.Now(), fc, gorm.ErrRecordNotFound)
+	logs := decodeLogs(t, b)
+	assert.Len(t, logs, 1)
+	assert.Equal(t, "debug", logs[0].Level)
+}
+
+func TestGormLogger_globalLogger(t *testing.T) {
+	l := NewGormLogger()
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	// the global logger is looked up when the statement is logged
+	b := &bytes.Buffer{}
+	defer oceanlog.ReplaceGlobal(oceanlog.New(oceanlog.WithOutput(b)))()
+	l.Trace(context.Background(), time.Now(), fc, nil)
+
+	logs := decodeLogs(t, b)
+	if assert.Len(t, logs, 1) {
+		assert.Contains(t, logs[0].Message, "[rows:1] SELECT 1")
+	}
+}
+
+func TestGormLogger_ParamsFilter(t *testing.T) {
+	l := NewGormLogger(WithRedactedArgs())
+
+	sql, params := l.ParamsFilter(context.Background(), "SELECT ?", "secret")
+	assert.Equal(t, "SELECT ?", sql)
+	assert.Equal(t, []interface{}{Redacted}, params)
+}
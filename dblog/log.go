@@ -0,0 +1,46 @@
+package dblog
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/v-mars/oceanlog"
+)
+
+// logStatement writes one finished statement, e.g.
+// "SLOW SQL >= 200ms user.go:42 [201.003ms] [rows:1] SELECT * FROM users WHERE id = ? args=[1] error: ..."
+func logStatement(opts *Options, ctx context.Context, level oceanlog.Level, caller string,
+	elapsed time.Duration, query string, args []interface{}, rows int64, err error) {
+	var b strings.Builder
+	v := make([]interface{}, 0, 6)
+
+	if level == oceanlog.LevelWarn && err == nil {
+		b.WriteString("SLOW SQL >= %v ")
+		v = append(v, opts.slowThreshold)
+	}
+	if caller != "" {
+		b.WriteString("%s ")
+		v = append(v, caller)
+	}
+	b.WriteString("[%.3fms] [rows:%s] %s")
+	v = append(v, float64(elapsed.Nanoseconds())/1e6, rowsString(rows), query)
+	if len(args) > 0 {
+		b.WriteString(" args=%v")
+		v = append(v, args)
+	}
+	if err != nil {
+		b.WriteString(" error: %v")
+		v = append(v, err)
+	}
+
+	opts.log().CtxLogf(level, ctx, b.String(), v...)
+}
+
+func rowsString(rows int64) string {
+	if rows < 0 {
+		return "-"
+	}
+	return strconv.FormatInt(rows, 10)
+}
@@ -0,0 +1,111 @@
+// Package dblog logs GORM and database/sql statements through oceanlog.
+package dblog
+
+import (
+	"time"
+
+	"github.com/v-mars/oceanlog"
+)
+
+// Redacted replaces every argument when WithRedactedArgs is used.
+const Redacted = "[REDACTED]"
+
+type (
+	// Options configures the GORM logger and the database/sql driver wrapper.
+	Options struct {
+		logger        *oceanlog.DefaultLogger
+		level         oceanlog.Level
+		slowThreshold time.Duration
+		redactArgs    func(query string, args []interface{}) []interface{}
+		ignoreNoRows  bool
+	}
+
+	Option func(opts *Options)
+)
+
+func newOptions(options []Option) *Options {
+	opts := &Options{
+		level:         oceanlog.LevelDebug,
+		slowThreshold: 200 * time.Millisecond,
+	}
+
+	for _, set := range options {
+		set(opts)
+	}
+	return opts
+}
+
+// WithLogger sets the logger statements are written to. By default, it is oceanlog.GetDefaultLogger()
+// at the time a statement is logged, so a later oceanlog.ReplaceGlobal applies.
+func WithLogger(l *oceanlog.DefaultLogger) Option {
+	return func(opts *Options) {
+		opts.logger = l
+	}
+}
+
+// WithLevel sets the level of successful statements. By default, it is LevelDebug.
+func WithLevel(level oceanlog.Level) Option {
+	return func(opts *Options) {
+		opts.level = level
+	}
+}
+
+// WithSlowThreshold logs statements slower than threshold at LevelWarn.
+// A zero threshold disables slow query detection.
+func WithSlowThreshold(threshold time.Duration) Option {
+	return func(opts *Options) {
+		opts.slowThreshold = threshold
+	}
+}
+
+// WithRedactedArgs replaces every statement argument with Redacted.
+func WithRedactedArgs() Option {
+	return WithArgsRedactor(func(query string, args []interface{}) []interface{} {
+		redacted := make([]interface{}, len(args))
+		for i := range redacted {
+			redacted[i] = Redacted
+		}
+		return redacted
+	})
+}
+
+// WithArgsRedactor allows to rewrite statement arguments before they are logged.
+func WithArgsRedactor(fn func(query string, args []interface{}) []interface{}) Option {
+	return func(opts *Options) {
+		opts.redactArgs = fn
+	}
+}
+
+// WithIgnoreRecordNotFound does not treat gorm.ErrRecordNotFound and sql.ErrNoRows as errors.
+func WithIgnoreRecordNotFound() Option {
+	return func(opts *Options) {
+		opts.ignoreNoRows = true
+	}
+}
+
+// log returns the logger of WithLogger, or the current global logger.
+func (o *Options) log() *oceanlog.DefaultLogger {
+	if o.logger != nil {
+		return o.logger
+	}
+	return oceanlog.GetDefaultLogger()
+}
+
+// levelOf picks the level of a finished statement.
+func (o *Options) levelOf(elapsed time.Duration, err error) oceanlog.Level {
+	switch {
+	case err != nil:
+		return oceanlog.LevelError
+	case o.slowThreshold > 0 && elapsed >= o.slowThreshold:
+		return oceanlog.LevelWarn
+	default:
+		return o.level
+	}
+}
+
+func (o *Options) args(query string, args []interface{}) []interface{} {
+	if o.redactArgs == nil || len(args) == 0 {
+		return args
+	}
+	return o.redactArgs(query, args)
+}
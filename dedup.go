@@ -0,0 +1,165 @@
+package oceanlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var _ zerolog.LevelWriter = (*DedupWriter)(nil)
+
+// DedupWriter collapses identical (level, message, caller) records written within a window.
+// The first record is written immediately, the repetitions are replaced by a single record
+// "repeated N times between T1 and T2" written when the window ends.
+// Records that are not JSON objects are written unchanged.
+type DedupWriter struct {
+	out       io.Writer
+	window    time.Duration
+	now       func() time.Time
+	timestamp timestampConf
+
+	mu      sync.Mutex
+	entries map[dedupKey]*dedupEntry
+	closed  bool
+}
+
+type dedupKey struct {
+	level   string
+	message string
+	caller  string
+}
+
+type dedupEntry struct {
+	zlevel zerolog.Level
+	count  int
+	first  time.Time
+	last   time.Time
+	timer  *time.Timer
+}
+
+// NewDedupWriter returns a DedupWriter writing to out. A window of zero defaults to one second.
+func NewDedupWriter(out io.Writer, window time.Duration) *DedupWriter {
+	if window <= 0 {
+		window = time.Second
+	}
+	return &DedupWriter{
+		out:       out,
+		window:    window,
+		now:       time.Now,
+		timestamp: timestampConf{format: zerolog.TimeFieldFormat},
+		entries:   map[dedupKey]*dedupEntry{},
+	}
+}
+
+// SetClock sets the clock of the time, first and last fields of the summaries. By default, it is SystemClock.
+func (w *DedupWriter) SetClock(c Clock) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.now = c.Now
+}
+
+// SetTimestampFormat sets the format of the time of the summaries, see WithFormattedTimestamp.
+// By default, it is zerolog.TimeFieldFormat when the writer is created.
+func (w *DedupWriter) SetTimestampFormat(format string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timestamp.format = format
+}
+
+// Write implements io.Writer.
+func (w *DedupWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (w *DedupWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	key, ok := parseDedupKey(p)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if ok && !w.closed {
+		now := w.now()
+		if e, found := w.entries[key]; found {
+			e.count++
+			e.last = now
+			return len(p), nil
+		}
+		e := &dedupEntry{zlevel: level, first: now, last: now}
+		e.timer = time.AfterFunc(w.window, func() { w.expire(key, e) })
+		w.entries[key] = e
+	}
+	return writeLevel(w.out, level, p)
+}
+
+// expire ends the window of one entry and writes its summary.
+func (w *DedupWriter) expire(key dedupKey, e *dedupEntry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.entries[key] != e {
+		return
+	}
+	delete(w.entries, key)
+	w.writeSummary(key, e)
+}
+
+// Close writes the summaries of every open window. Later records are written unchanged.
+func (w *DedupWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.closed = true
+	for key, e := range w.entries {
+		e.timer.Stop()
+		delete(w.entries, key)
+		w.writeSummary(key, e)
+	}
+	return nil
+}
+
+func (w *DedupWriter) writeSummary(key dedupKey, e *dedupEntry) {
+	if e.count == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	zl := zerolog.New(&buf)
+	record := zl.Log().Str(zerolog.LevelFieldName, key.level)
+	w.timestamp.stamp(record, w.now())
+	if key.caller != "" {
+		record.Str(zerolog.CallerFieldName, key.caller)
+	}
+	record.Int("repeated", e.count).
+		Str("first", e.first.Format(time.RFC3339Nano)).
+		Str("last", e.last.Format(time.RFC3339Nano)).
+		Msgf("%s (repeated %d times between %s and %s)", key.message, e.count,
+			e.first.Format(time.RFC3339), e.last.Format(time.RFC3339))
+	_, _ = writeLevel(w.out, e.zlevel, buf.Bytes())
+}
+
+func parseDedupKey(p []byte) (dedupKey, bool) {
+	if len(p) == 0 || p[0] != '{' {
+		return dedupKey{}, false
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(bytes.TrimSpace(p), &fields); err != nil {
+		return dedupKey{}, false
+	}
+	var key dedupKey
+	_ = json.Unmarshal(fields[zerolog.LevelFieldName], &key.level)
+	_ = json.Unmarshal(fields[zerolog.MessageFieldName], &key.message)
+	_ = json.Unmarshal(fields[zerolog.CallerFieldName], &key.caller)
+	return key, true
+}
+
+// writeLevel writes p to w, keeping the level if w is a zerolog.LevelWriter.
+func writeLevel(w io.Writer, level zerolog.Level, p []byte) (int, error) {
+	if lw, ok := w.(zerolog.LevelWriter); ok && level != zerolog.NoLevel {
+		return lw.WriteLevel(level, p)
+	}
+	return w.Write(p)
+}
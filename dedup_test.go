@@ -0,0 +1,105 @@
+package oceanlog
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupWriter(t *testing.T) {
+	b := &syncBuffer{}
+	w := NewDedupWriter(b, time.Hour)
+	l := New(WithOutput(w))
+
+	for i := 0; i < 5; i++ {
+		l.Error("connection refused")
+	}
+	l.Warn("connection refused")
+	l.Error("other")
+	assert.Len(t, b.Lines(), 3)
+
+	assert.NoError(t, w.Close())
+	lines := b.Lines()
+	assert.Len(t, lines, 4)
+
+	var summary struct {
+		Level    string `json:"level"`
+		Repeated int    `json:"repeated"`
+		Message  string `json:"message"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(lines[3]), &summary))
+	assert.Equal(t, "error", summary.Level)
+	assert.Equal(t, 4, summary.Repeated)
+	assert.Contains(t, summary.Message, "connection refused (repeated 4 times between ")
+}
+
+func TestDedupWriter_window(t *testing.T) {
+	b := &syncBuffer{}
+	w := NewDedupWriter(b, 20*time.Millisecond)
+	l := New(WithOutput(w), WithCaller())
+
+	l.Info("tick")
+	l.Info("tick")
+	assert.Eventually(t, func() bool { return len(b.Lines()) == 2 }, time.Second, 5*time.Millisecond)
+
+	// a new window starts with the next occurrence
+	l.Info("tick")
+	assert.Len(t, b.Lines(), 3)
+	assert.NoError(t, w.Close())
+	assert.Len(t, b.Lines(), 3)
+}
+
+func TestDedupWriter_summaryTime(t *testing.T) {
+	b := &syncBuffer{}
+	w := NewDedupWriter(b, time.Hour)
+	w.SetClock(ClockFunc(func() time.Time { return time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC) }))
+	w.SetTimestampFormat(TimeFormatUnix)
+	l := New(WithOutput(w), WithoutCaller())
+
+	l.Warn("disk full")
+	l.Warn("disk full")
+	assert.NoError(t, w.Close())
+
+	lines := b.Lines()
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, `{"level":"warn","time":1714979289,"repeated":1,"first":"2024-05-06T07:08:09Z",`+
+			`"last":"2024-05-06T07:08:09Z","message":"disk full (repeated 1 times between 2024-05-06T07:08:09Z and 2024-05-06T07:08:09Z)"}`,
+			lines[1])
+	}
+}
+
+func TestDedupWriter_nonJSON(t *testing.T) {
+	b := &syncBuffer{}
+	w := NewDedupWriter(b, time.Hour)
+
+	_, _ = w.Write([]byte("plain\n"))
+	_, _ = w.Write([]byte("plain\n"))
+
+	assert.Equal(t, []string{"plain", "plain"}, b.Lines())
+}
+
+func TestDedupWriter_concurrent(t *testing.T) {
+	b := &syncBuffer{}
+	w := NewDedupWriter(b, time.Hour)
+	l := New(WithOutput(w))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.Info("same")
+			}
+		}()
+	}
+	wg.Wait()
+	assert.NoError(t, w.Close())
+
+	lines := b.Lines()
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[1], `"repeated":799`)
+}
@@ -2,151 +2,195 @@ package oceanlog
 
 import (
 	"context"
-	"github.com/cloudwego/hertz/pkg/common/hlog"
 	"io"
-)
+	"sync/atomic"
 
-var logger = New(
-	WithFormattedTimestamp("2006-01-02 15:04:05"), // option with timestamp
+	"github.com/cloudwego/hertz/pkg/common/hlog"
 )
 
+// logger is the default logger, read without locking by the package level functions.
+var logger atomic.Pointer[DefaultLogger]
+
+func init() {
+	logger.Store(New(
+		WithFormattedTimestamp("2006-01-02 15:04:05"), // option with timestamp
+		WithCaller(), // the package level wrappers are skipped
+	))
+}
+
 // SetOutput sets the output of default logs. By default, it is stderr.
 func SetOutput(w io.Writer) {
-	logger.SetOutput(w)
+	GetDefaultLogger().SetOutput(w)
 }
 
 // SetLevel sets the level of logs below which logs will not be output.
 // The default log level is LevelTrace.
-// Note that this method is not concurrent-safe.
+// It is safe to call while other goroutines are logging.
 func SetLevel(lv hlog.Level) {
-	logger.SetLevel(lv)
+	GetDefaultLogger().SetLevel(lv)
 }
 
 // GetDefaultLogger return the default logs for kitex.
 func GetDefaultLogger() *DefaultLogger {
-	return logger
+	return logger.Load()
 }
 
-// SetLogger sets the default logs.
-// Note that this method is not concurrent-safe and must not be called
-// after the use of GetDefaultLogger and global functions in this package.
+// SetLogger sets the default logs. It is safe to call concurrently with the package level functions.
 func SetLogger(v interface{}) {
-	if v == nil {
-		return
+	if l, ok := v.(*DefaultLogger); ok && l != nil {
+		logger.Store(l)
 	}
+}
 
-	// 类型断言检查
-	if l, ok := v.(*DefaultLogger); ok {
-		// 添加并发保护
-		loggerMutex.Lock()
-		defer loggerMutex.Unlock()
+type (
+	globalOptions struct {
+		hlog bool
+	}
+
+	// GlobalOpt configures ReplaceGlobal.
+	GlobalOpt func(opts *globalOptions)
+)
 
-		logger = l
-		return
+// WithHlog installs the logger into hlog.SetLogger as well.
+func WithHlog() GlobalOpt {
+	return func(opts *globalOptions) {
+		opts.hlog = true
 	}
 }
 
-// Fatal calls the default logs's Fatal method and then os.Exit(1).
+// ReplaceGlobal sets l as the default logger and returns a function restoring the previous one,
+// e.g. for a test:
+//
+//	defer oceanlog.ReplaceGlobal(l, oceanlog.WithHlog())()
+//
+// Like SetLogger, a nil l leaves the default logger unchanged.
+func ReplaceGlobal(l *DefaultLogger, options ...GlobalOpt) func() {
+	if l == nil {
+		return func() {}
+	}
+	opts := &globalOptions{}
+	for _, set := range options {
+		set(opts)
+	}
+
+	prev := logger.Swap(l)
+	if !opts.hlog {
+		return func() { logger.Store(prev) }
+	}
+	prevHlog := hlog.DefaultLogger()
+	hlog.SetLogger(l)
+	return func() {
+		logger.Store(prev)
+		hlog.SetLogger(prevHlog)
+	}
+}
+
+// Fatal calls the default logs's Fatal method and then the exit function of the logger, os.Exit(1) by default.
 func Fatal(v ...interface{}) {
-	logger.Fatal(v...)
+	GetDefaultLogger().Fatal(v...)
 }
 
 // Error calls the default logs's Error method.
 func Error(v ...interface{}) {
-	logger.Error(v...)
+	GetDefaultLogger().Error(v...)
 }
 
 // Warn calls the default logs's Warn method.
 func Warn(v ...interface{}) {
-	logger.Warn(v...)
+	GetDefaultLogger().Warn(v...)
 }
 
 // Notice calls the default logs's Notice method.
 func Notice(v ...interface{}) {
-	logger.Notice(v...)
+	GetDefaultLogger().Notice(v...)
 }
 
 // Info calls the default logs's Info method.
 func Info(v ...interface{}) {
-	logger.Info(v...)
+	GetDefaultLogger().Info(v...)
 }
 
 // Debug calls the default logs's Debug method.
 func Debug(v ...interface{}) {
-	logger.Debug(v...)
+	GetDefaultLogger().Debug(v...)
 }
 
 // Trace calls the default logs's Trace method.
 func Trace(v ...interface{}) {
-	logger.Trace(v...)
+	GetDefaultLogger().Trace(v...)
 }
 
-// Fatalf calls the default logs's Fatalf method and then os.Exit(1).
+// Fatalf calls the default logs's Fatalf method and then the exit function of the logger, os.Exit(1) by default.
 func Fatalf(format string, v ...interface{}) {
-	logger.Fatalf(format, v...)
+	GetDefaultLogger().Fatalf(format, v...)
 }
 
 // Errorf calls the default logs's Errorf method.
 func Errorf(format string, v ...interface{}) {
-	logger.Errorf(format, v...)
+	GetDefaultLogger().Errorf(format, v...)
 }
 
 // Warnf calls the default logs's Warnf method.
 func Warnf(format string, v ...interface{}) {
-	logger.Warnf(format, v...)
+	GetDefaultLogger().Warnf(format, v...)
 }
 
 // Noticef calls the default logs's Noticef method.
 func Noticef(format string, v ...interface{}) {
-	logger.Noticef(format, v...)
+	GetDefaultLogger().Noticef(format, v...)
 }
 
 // Infof calls the default logs's Infof method.
 func Infof(format string, v ...interface{}) {
-	logger.Infof(format, v...)
+	GetDefaultLogger().Infof(format, v...)
 }
 
 // Debugf calls the default logs's Debugf method.
 func Debugf(format string, v ...interface{}) {
-	logger.Debugf(format, v...)
+	GetDefaultLogger().Debugf(format, v...)
 }
 
 // Tracef calls the default logs's Tracef method.
 func Tracef(format string, v ...interface{}) {
-	logger.Tracef(format, v...)
+	GetDefaultLogger().Tracef(format, v...)
 }
 
-// CtxFatalf calls the default logs's CtxFatalf method and then os.Exit(1).
+// CtxFatalf calls the default logs's CtxFatalf method and then the exit function of the logger, os.Exit(1) by default.
 func CtxFatalf(ctx context.Context, format string, v ...interface{}) {
-	logger.CtxFatalf(ctx, format, v...)
+	GetDefaultLogger().CtxFatalf(ctx, format, v...)
+}
+
+// CtxErrorw calls the default logs's CtxErrorw method.
+func CtxErrorw(ctx context.Context, err error, msg string, fields ...interface{}) {
+	GetDefaultLogger().CtxErrorw(ctx, err, msg, fields...)
 }
 
 // CtxErrorf calls the default logs's CtxErrorf method.
 func CtxErrorf(ctx context.Context, format string, v ...interface{}) {
-	logger.CtxErrorf(ctx, format, v...)
+	GetDefaultLogger().CtxErrorf(ctx, format, v...)
 }
 
 // CtxWarnf calls the default logs's CtxWarnf method.
 func CtxWarnf(ctx context.Context, format string, v ...interface{}) {
-	logger.CtxWarnf(ctx, format, v...)
+	GetDefaultLogger().CtxWarnf(ctx, format, v...)
 }
 
 // CtxNoticef calls the default logs's CtxNoticef method.
 func CtxNoticef(ctx context.Context, format string, v ...interface{}) {
-	logger.CtxNoticef(ctx, format, v...)
+	GetDefaultLogger().CtxNoticef(ctx, format, v...)
 }
 
 // CtxInfof calls the default logs's CtxInfof method.
 func CtxInfof(ctx context.Context, format string, v ...interface{}) {
-	logger.CtxInfof(ctx, format, v...)
+	GetDefaultLogger().CtxInfof(ctx, format, v...)
 }
 
 // CtxDebugf calls the default logs's CtxDebugf method.
 func CtxDebugf(ctx context.Context, format string, v ...interface{}) {
-	logger.CtxDebugf(ctx, format, v...)
+	GetDefaultLogger().CtxDebugf(ctx, format, v...)
 }
 
 // CtxTracef calls the default logs's CtxTracef method.
 func CtxTracef(ctx context.Context, format string, v ...interface{}) {
-	logger.CtxTracef(ctx, format, v...)
+	GetDefaultLogger().CtxTracef(ctx, format, v...)
 }
@@ -0,0 +1,500 @@
+package oceanlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var _ zerolog.LevelWriter = (*ElasticsearchWriter)(nil)
+
+// ECSVersion is the version of the Elastic Common Schema of the ElasticsearchConf.ECS mapping.
+const ECSVersion = "8.11.0"
+
+// ElasticsearchConf configures an ElasticsearchWriter. It works with OpenSearch as well.
+type ElasticsearchConf struct {
+	URL      string `json:"url"`      // http://elasticsearch:9200
+	Username string `json:"username"` // basic authentication
+	Password string `json:"password"`
+	APIKey   string `json:"api_key"` // encoded API key, instead of basic authentication
+	// Index is the index name, with the date of the record formatted by Go layouts in braces,
+	// "oceanlog-{2006.01.02}" by default. Data streams are supported.
+	Index string `json:"index"`
+	// ECS maps the fields to the Elastic Common Schema, e.g. level to log.level.
+	ECS bool `json:"ecs"`
+	// DeadLetter is the file receiving, as JSON lines, the documents the cluster rejected
+	// or that still failed after MaxRetries. Empty, they are dropped.
+	DeadLetter string        `json:"dead_letter"`
+	BatchSize  int           `json:"batch_size"`  // bytes per bulk request, 5 MiB by default
+	BatchWait  time.Duration `json:"batch_wait"`  // maximum delay of a record, 1s by default
+	MaxBuffer  int           `json:"max_buffer"`  // bytes kept while the cluster is unavailable, 64 MiB by default
+	MinBackoff time.Duration `json:"min_backoff"` // first retry delay, 500ms by default
+	MaxBackoff time.Duration `json:"max_backoff"` // 30s by default
+	MaxRetries int           `json:"max_retries"` // 10 by default
+	Timeout    time.Duration `json:"timeout"`     // per bulk request, 30s by default
+}
+
+// ElasticsearchWriter indexes JSON records with _bulk requests, batching them in the background.
+// Requests and documents failing with 429 or 5xx are retried with exponential backoff; rejected documents
+// go to the dead-letter file. The buffer is bounded by MaxBuffer, the oldest records are dropped beyond.
+type ElasticsearchWriter struct {
+	conf   ElasticsearchConf
+	client *http.Client
+	index  []indexPart
+
+	mu      sync.Mutex
+	now     func() time.Time
+	pending []esDocument
+	size    int
+	dropped int
+	closed  bool
+
+	// send serializes the bulk requests and guards deadLetter
+	send       sync.Mutex
+	deadLetter *os.File
+
+	full chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type esDocument struct {
+	index string
+	body  []byte
+}
+
+// indexPart is a literal part of the index name, or a date layout.
+type indexPart struct {
+	text   string
+	layout bool
+}
+
+var indexLayout = regexp.MustCompile(`\{[^{}]+\}`)
+
+// NewElasticsearchWriter returns a writer indexing to the cluster of conf.
+func NewElasticsearchWriter(conf ElasticsearchConf) (*ElasticsearchWriter, error) {
+	if conf.URL == "" {
+		return nil, fmt.Errorf("elasticsearch: no url")
+	}
+	conf.URL = strings.TrimRight(conf.URL, "/")
+	if conf.Index == "" {
+		conf.Index = "oceanlog-{2006.01.02}"
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 5 << 20
+	}
+	if conf.BatchWait <= 0 {
+		conf.BatchWait = time.Second
+	}
+	if conf.MaxBuffer <= 0 {
+		conf.MaxBuffer = 64 << 20
+	}
+	if conf.MinBackoff <= 0 {
+		conf.MinBackoff = 500 * time.Millisecond
+	}
+	if conf.MaxBackoff <= 0 {
+		conf.MaxBackoff = 30 * time.Second
+	}
+	if conf.MaxRetries <= 0 {
+		conf.MaxRetries = 10
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 30 * time.Second
+	}
+
+	w := &ElasticsearchWriter{
+		conf:   conf,
+		client: &http.Client{Timeout: conf.Timeout},
+		now:    time.Now,
+		full:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	last := 0
+	for _, m := range indexLayout.FindAllStringIndex(conf.Index, -1) {
+		w.index = append(w.index, indexPart{text: conf.Index[last:m[0]]},
+			indexPart{text: conf.Index[m[0]+1 : m[1]-1], layout: true})
+		last = m[1]
+	}
+	w.index = append(w.index, indexPart{text: conf.Index[last:]})
+	if conf.DeadLetter != "" {
+		f, err := os.OpenFile(conf.DeadLetter, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("elasticsearch: dead letter: %w", err)
+		}
+		w.deadLetter = f
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// SetClock sets the clock of the @timestamp field and of the index dates. By default, it is SystemClock.
+func (w *ElasticsearchWriter) SetClock(c Clock) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.now = c.Now
+}
+
+// Write implements io.Writer.
+func (w *ElasticsearchWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (w *ElasticsearchWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	r := parseRecord(p, level)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, fmt.Errorf("elasticsearch: writer closed")
+	}
+	t := r.timeOr(w.now)
+	doc := esDocument{index: w.indexName(t), body: w.document(r, p, t)}
+	w.pending = append(w.pending, doc)
+	w.size += len(doc.body)
+	for w.size > w.conf.MaxBuffer && len(w.pending) > 1 {
+		w.size -= len(w.pending[0].body)
+		w.pending[0] = esDocument{}
+		w.pending = w.pending[1:]
+		w.dropped++
+	}
+	if w.size >= w.conf.BatchSize {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Flush indexes the pending records.
+func (w *ElasticsearchWriter) Flush() error {
+	w.send.Lock()
+	defer w.send.Unlock()
+
+	docs, dropped := w.take()
+	if dropped > 0 {
+		log.Printf("elasticsearch: dropped %d records, buffer limit %d bytes reached", dropped, w.conf.MaxBuffer)
+	}
+	var errs []error
+	for len(docs) > 0 {
+		n, size := 1, len(docs[0].body)
+		for n < len(docs) && size+len(docs[n].body) <= w.conf.BatchSize {
+			size += len(docs[n].body)
+			n++
+		}
+		if err := w.bulk(docs[:n]); err != nil {
+			errs = append(errs, err)
+		}
+		docs = docs[n:]
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("elasticsearch: %w", errs[0])
+	}
+	return nil
+}
+
+// Close stops the writer, indexes the pending records without retrying and closes the dead-letter file.
+func (w *ElasticsearchWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.done)
+	w.wg.Wait()
+	err := w.Flush()
+	w.send.Lock()
+	defer w.send.Unlock()
+	if w.deadLetter != nil {
+		_ = w.deadLetter.Close()
+		w.deadLetter = nil
+	}
+	return err
+}
+
+func (w *ElasticsearchWriter) run() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.conf.BatchWait)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.full:
+		case <-w.done:
+			return
+		}
+		if err := w.Flush(); err != nil {
+			log.Println(err.Error())
+		}
+	}
+}
+
+// take returns the pending documents and the number of records dropped since the last call.
+func (w *ElasticsearchWriter) take() ([]esDocument, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	docs, dropped := w.pending, w.dropped
+	w.pending, w.size, w.dropped = nil, 0, 0
+	return docs, dropped
+}
+
+// bulk indexes docs, retrying the request or the documents failing with 429 or 5xx.
+// The rejected documents and the ones still failing after MaxRetries go to the dead-letter file.
+func (w *ElasticsearchWriter) bulk(docs []esDocument) error {
+	backoff := w.conf.MinBackoff
+	var first *esFailure
+	rejected := 0
+	for attempt := 0; ; attempt++ {
+		failed, err := w.post(docs)
+		var retry []esDocument
+		var dead []esFailure
+		for _, f := range failed {
+			if f.temporary() && attempt < w.conf.MaxRetries {
+				retry = append(retry, f.doc)
+			} else {
+				dead = append(dead, f)
+			}
+		}
+		w.reject(dead)
+		if len(dead) > 0 && first == nil {
+			first = &dead[0]
+		}
+		rejected += len(dead)
+		if len(retry) == 0 {
+			if rejected > 0 {
+				return fmt.Errorf("%d documents rejected, first: %d %s", rejected, first.status, first.reason)
+			}
+			return err
+		}
+		if !w.wait(backoff) {
+			w.reject(failures(retry, 0, "writer closed"))
+			return fmt.Errorf("%d documents not indexed: writer closed", len(retry))
+		}
+		if backoff *= 2; backoff > w.conf.MaxBackoff {
+			backoff = w.conf.MaxBackoff
+		}
+		docs = retry
+	}
+}
+
+// wait sleeps for d, it returns false if the writer is closed meanwhile.
+func (w *ElasticsearchWriter) wait(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+type esFailure struct {
+	doc    esDocument
+	status int
+	reason string
+}
+
+// temporary reports whether the failure may succeed later: throttling, server errors and network errors.
+func (f esFailure) temporary() bool {
+	return f.status == 0 || f.status == http.StatusTooManyRequests || f.status/100 == 5
+}
+
+func failures(docs []esDocument, status int, reason string) []esFailure {
+	fs := make([]esFailure, len(docs))
+	for i, d := range docs {
+		fs[i] = esFailure{doc: d, status: status, reason: reason}
+	}
+	return fs
+}
+
+// post sends one bulk request and returns the documents that failed.
+func (w *ElasticsearchWriter) post(docs []esDocument) ([]esFailure, error) {
+	var body bytes.Buffer
+	for _, d := range docs {
+		action, _ := json.Marshal(map[string]map[string]string{"create": {"_index": d.index}})
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(d.body)
+		body.WriteByte('\n')
+	}
+	req, err := http.NewRequest(http.MethodPost, w.conf.URL+"/_bulk", &body)
+	if err != nil {
+		return failures(docs, -1, err.Error()), err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if w.conf.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+w.conf.APIKey)
+	} else if w.conf.Username != "" {
+		req.SetBasicAuth(w.conf.Username, w.conf.Password)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return failures(docs, 0, err.Error()), err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+		return failures(docs, resp.StatusCode, err.Error()), err
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		err = fmt.Errorf("bulk response: %w", err)
+		return failures(docs, 0, err.Error()), err
+	}
+	if !result.Errors {
+		return nil, nil
+	}
+	var failed []esFailure
+	for i, item := range result.Items {
+		if i >= len(docs) {
+			break
+		}
+		for _, r := range item {
+			if r.Status/100 != 2 {
+				failed = append(failed, esFailure{doc: docs[i], status: r.Status, reason: string(r.Error)})
+			}
+		}
+	}
+	return failed, nil
+}
+
+// reject writes the failed documents to the dead-letter file.
+func (w *ElasticsearchWriter) reject(failed []esFailure) {
+	if len(failed) == 0 {
+		return
+	}
+	if w.deadLetter == nil {
+		log.Printf("elasticsearch: dropped %d documents: %d %s", len(failed), failed[0].status, failed[0].reason)
+		return
+	}
+	// the time of the rejection, the document keeps the @timestamp of the record
+	w.mu.Lock()
+	now := w.now()
+	w.mu.Unlock()
+	bw := bufio.NewWriter(w.deadLetter)
+	for _, f := range failed {
+		line, _ := json.Marshal(struct {
+			Time     time.Time       `json:"time"`
+			Index    string          `json:"index"`
+			Status   int             `json:"status"`
+			Error    string          `json:"error"`
+			Document json.RawMessage `json:"document"`
+		}{now, f.doc.index, f.status, f.reason, f.doc.body})
+		_, _ = bw.Write(line)
+		_ = bw.WriteByte('\n')
+	}
+	if err := bw.Flush(); err != nil {
+		log.Printf("elasticsearch: dead letter: %v", err)
+	}
+}
+
+// indexName returns the index of the records written at t.
+func (w *ElasticsearchWriter) indexName(t time.Time) string {
+	var b strings.Builder
+	for _, p := range w.index {
+		if p.layout {
+			b.WriteString(t.UTC().Format(p.text))
+		} else {
+			b.WriteString(p.text)
+		}
+	}
+	return strings.ToLower(b.String())
+}
+
+// ecsFields maps the oceanlog fields to the Elastic Common Schema.
+var ecsFields = map[string]string{
+	zerolog.LevelFieldName: "log.level",
+	LoggerFieldName:        "log.logger",
+	traceIDKey:             "trace.id",
+	spanIDKey:              "span.id",
+	LogIDKey:               "http.request.id",
+}
+
+// document returns the document of the record r, decoded from p, with an @timestamp field set to t.
+func (w *ElasticsearchWriter) document(r record, p []byte, t time.Time) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"@timestamp":`)
+	ts, _ := json.Marshal(t.UTC().Format(time.RFC3339Nano))
+	b.Write(ts)
+	field := func(key string, value []byte) {
+		b.WriteByte(',')
+		k, _ := json.Marshal(key)
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	str := func(s string) []byte {
+		v, _ := json.Marshal(s)
+		return v
+	}
+
+	if !r.json {
+		field(zerolog.MessageFieldName, str(r.message))
+		if r.level != "" {
+			field(w.key(zerolog.LevelFieldName), str(r.level))
+		}
+		b.WriteByte('}')
+		return b.Bytes()
+	}
+	if !w.conf.ECS {
+		// the record as is, after @timestamp
+		p = bytes.TrimSpace(p)
+		if len(p) > 2 {
+			b.WriteByte(',')
+			b.Write(p[1:])
+		} else {
+			b.WriteByte('}')
+		}
+		return b.Bytes()
+	}
+
+	field("ecs.version", str(ECSVersion))
+	if r.level != "" {
+		field("log.level", str(r.level))
+	}
+	field(zerolog.MessageFieldName, str(r.message))
+	for _, f := range r.fields {
+		if f.key == zerolog.CallerFieldName {
+			file, line, ok := splitCaller(f.String())
+			if n, err := strconv.Atoi(line); ok && err == nil {
+				field("log.origin.file.name", str(file))
+				field("log.origin.file.line", []byte(strconv.Itoa(n)))
+				continue
+			}
+		}
+		field(w.key(f.key), f.value)
+	}
+	b.WriteByte('}')
+	return b.Bytes()
+}
+
+// key returns the document field name of the record field key.
+func (w *ElasticsearchWriter) key(key string) string {
+	if ecs, ok := ecsFields[key]; ok && w.conf.ECS {
+		return ecs
+	}
+	return key
+}
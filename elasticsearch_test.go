@@ -0,0 +1,276 @@
+package oceanlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type esIndexed struct {
+	index string
+	doc   map[string]interface{}
+}
+
+// fakeCluster is a _bulk endpoint. It fails the first failures requests with status, rejects the documents
+// whose message contains "reject" and throttles once the ones whose message contains "throttle".
+type fakeCluster struct {
+	*httptest.Server
+	status   atomic.Int32
+	failures atomic.Int32
+	requests atomic.Int32
+
+	mu        sync.Mutex
+	indexed   []esIndexed
+	throttled map[string]bool
+	auth      string
+}
+
+func newFakeCluster(t *testing.T) *fakeCluster {
+	c := &fakeCluster{throttled: map[string]bool{}}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.requests.Add(1) <= c.failures.Load() {
+			w.WriteHeader(int(c.status.Load()))
+			return
+		}
+		assert.Equal(t, "/_bulk", r.URL.Path)
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.auth = r.Header.Get("Authorization")
+		var items []map[string]interface{}
+		errors := false
+		s := bufio.NewScanner(r.Body)
+		s.Buffer(nil, 1<<20)
+		for s.Scan() {
+			var action map[string]map[string]string
+			assert.NoError(t, json.Unmarshal(s.Bytes(), &action))
+			s.Scan()
+			var doc map[string]interface{}
+			assert.NoError(t, json.Unmarshal(s.Bytes(), &doc))
+			msg, _ := doc["message"].(string)
+			status := http.StatusCreated
+			switch {
+			case strings.Contains(msg, "reject"):
+				status = http.StatusBadRequest
+			case strings.Contains(msg, "throttle") && !c.throttled[msg]:
+				c.throttled[msg] = true
+				status = http.StatusTooManyRequests
+			default:
+				c.indexed = append(c.indexed, esIndexed{index: action["create"]["_index"], doc: doc})
+			}
+			item := map[string]interface{}{"status": status}
+			if status != http.StatusCreated {
+				errors = true
+				item["error"] = map[string]string{"type": http.StatusText(status)}
+			}
+			items = append(items, map[string]interface{}{"create": item})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"errors": errors, "items": items})
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+func (c *fakeCluster) documents() []esIndexed {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]esIndexed(nil), c.indexed...)
+}
+
+func TestElasticsearchWriter(t *testing.T) {
+	es := newFakeCluster(t)
+	w, err := NewElasticsearchWriter(ElasticsearchConf{URL: es.URL + "/", Index: "Logs-{2006.01}-{02}",
+		Username: "elastic", Password: "secret", BatchWait: time.Hour})
+	assert.NoError(t, err)
+	defer w.Close()
+	w.SetClock(syslogTime)
+	l := New(WithOutput(w), WithoutCaller()).WithField("user", "alice")
+
+	l.Info("indexed")
+	_, _ = w.Write([]byte("plain text\n"))
+	assert.NoError(t, w.Flush())
+
+	docs := es.documents()
+	if assert.Len(t, docs, 2) {
+		assert.Equal(t, "logs-2024.05-06", docs[0].index)
+		assert.Equal(t, map[string]interface{}{"@timestamp": "2024-05-06T07:08:09.123456Z", "level": "info",
+			"user": "alice", "message": "indexed"}, docs[0].doc)
+		assert.Equal(t, map[string]interface{}{"@timestamp": "2024-05-06T07:08:09.123456Z",
+			"message": "plain text"}, docs[1].doc)
+	}
+	assert.True(t, strings.HasPrefix(es.auth, "Basic "))
+}
+
+func TestElasticsearchWriter_recordTime(t *testing.T) {
+	es := newFakeCluster(t)
+	w, err := NewElasticsearchWriter(ElasticsearchConf{URL: es.URL, Index: "logs-{2006.01.02}", BatchWait: time.Hour})
+	assert.NoError(t, err)
+	defer w.Close()
+	w.SetClock(syslogTime)
+
+	// a record replayed from a spool keeps its time and date index
+	_, _ = w.Write([]byte(`{"time":"2024-05-01T23:59:59+08:00","message":"replayed"}` + "\n"))
+	_, _ = w.Write([]byte(`{"time":"yesterday","message":"unparsable"}` + "\n"))
+	assert.NoError(t, w.Flush())
+
+	docs := es.documents()
+	if assert.Len(t, docs, 2) {
+		assert.Equal(t, "logs-2024.05.01", docs[0].index)
+		assert.Equal(t, "2024-05-01T15:59:59Z", docs[0].doc["@timestamp"])
+		assert.Equal(t, "logs-2024.05.06", docs[1].index)
+		assert.Equal(t, "2024-05-06T07:08:09.123456Z", docs[1].doc["@timestamp"])
+	}
+}
+
+func TestElasticsearchWriter_ecs(t *testing.T) {
+	es := newFakeCluster(t)
+	w, err := NewElasticsearchWriter(ElasticsearchConf{URL: es.URL, ECS: true, APIKey: "key", BatchWait: time.Hour})
+	assert.NoError(t, err)
+	defer w.Close()
+	w.SetClock(syslogTime)
+	l := New(WithOutput(w), WithCaller(), WithName("api"))
+
+	l.CtxWarnf(ContextWithRequestID(t.Context(), "r1"), "slow")
+	assert.NoError(t, w.Flush())
+
+	docs := es.documents()
+	if assert.Len(t, docs, 1) {
+		doc := docs[0].doc
+		assert.Equal(t, "oceanlog-2024.05.06", docs[0].index)
+		assert.Equal(t, ECSVersion, doc["ecs.version"])
+		assert.Equal(t, "warn", doc["log.level"])
+		assert.Equal(t, "slow", doc["message"])
+		assert.Equal(t, "api", doc["log.logger"])
+		assert.Equal(t, "r1", doc["http.request.id"])
+		assert.Equal(t, "elasticsearch_test.go", doc["log.origin.file.name"])
+		assert.IsType(t, float64(0), doc["log.origin.file.line"])
+		assert.NotContains(t, doc, "caller")
+	}
+	assert.Equal(t, "ApiKey key", es.auth)
+}
+
+func TestElasticsearchWriter_retry(t *testing.T) {
+	es := newFakeCluster(t)
+	es.status.Store(http.StatusServiceUnavailable)
+	es.failures.Store(1)
+	deadLetter := filepath.Join(t.TempDir(), "dead.jsonl")
+	w, err := NewElasticsearchWriter(ElasticsearchConf{URL: es.URL, DeadLetter: deadLetter, BatchWait: time.Hour,
+		MinBackoff: time.Millisecond})
+	assert.NoError(t, err)
+	defer w.Close()
+	l := New(WithOutput(w))
+
+	l.Info("first")
+	l.Info("throttle me")
+	l.Info("reject me")
+	l.Info("last")
+	assert.ErrorContains(t, w.Flush(), "1 documents rejected, first: 400")
+
+	// the request failing with 503 and the throttled document were retried
+	var messages []string
+	for _, d := range es.documents() {
+		messages = append(messages, d.doc["message"].(string))
+	}
+	assert.Equal(t, []string{"first", "last", "throttle me"}, messages)
+	assert.Equal(t, int32(3), es.requests.Load())
+
+	b, err := os.ReadFile(deadLetter)
+	assert.NoError(t, err)
+	var dead struct {
+		Index    string                 `json:"index"`
+		Status   int                    `json:"status"`
+		Error    string                 `json:"error"`
+		Document map[string]interface{} `json:"document"`
+	}
+	assert.NoError(t, json.Unmarshal(b, &dead))
+	assert.Equal(t, 400, dead.Status)
+	assert.Contains(t, dead.Error, "Bad Request")
+	assert.Equal(t, "reject me", dead.Document["message"])
+}
+
+func TestElasticsearchWriter_maxRetries(t *testing.T) {
+	es := newFakeCluster(t)
+	es.status.Store(http.StatusTooManyRequests)
+	es.failures.Store(100)
+	deadLetter := filepath.Join(t.TempDir(), "dead.jsonl")
+	w, err := NewElasticsearchWriter(ElasticsearchConf{URL: es.URL, DeadLetter: deadLetter, BatchWait: time.Hour,
+		MinBackoff: time.Millisecond, MaxRetries: 2})
+	assert.NoError(t, err)
+	defer w.Close()
+
+	New(WithOutput(w)).Info("given up")
+	assert.ErrorContains(t, w.Flush(), "429")
+	assert.Equal(t, int32(3), es.requests.Load())
+	b, err := os.ReadFile(deadLetter)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"message":"given up"`)
+}
+
+func TestElasticsearchWriter_bounded(t *testing.T) {
+	es := newFakeCluster(t)
+	w, err := NewElasticsearchWriter(ElasticsearchConf{URL: es.URL, BatchWait: time.Hour, MaxBuffer: 300,
+		BatchSize: 1 << 20})
+	assert.NoError(t, err)
+	defer w.Close()
+	w.SetClock(syslogTime)
+
+	l := New(WithOutput(w), WithoutCaller())
+	for i := 0; i < 10; i++ {
+		l.Infof("record %d", i)
+	}
+	assert.NoError(t, w.Flush())
+	docs := es.documents()
+	// each document takes 80 bytes, the newest ones are kept
+	if assert.Len(t, docs, 3) {
+		assert.Equal(t, "record 9", docs[2].doc["message"])
+	}
+}
+
+func TestElasticsearchWriter_batch(t *testing.T) {
+	es := newFakeCluster(t)
+	w, err := NewElasticsearchWriter(ElasticsearchConf{URL: es.URL, BatchWait: time.Hour, BatchSize: 200})
+	assert.NoError(t, err)
+	defer w.Close()
+
+	l := New(WithOutput(w))
+	for i := 0; i < 5; i++ {
+		l.Infof("record %d", i)
+	}
+	// BatchSize triggers background requests of at most 200 bytes
+	assert.Eventually(t, func() bool { return len(es.documents()) >= 4 }, time.Second, time.Millisecond)
+	assert.NoError(t, w.Flush())
+	assert.Len(t, es.documents(), 5)
+	assert.GreaterOrEqual(t, es.requests.Load(), int32(3))
+}
+
+func TestElasticsearchWriter_conf(t *testing.T) {
+	_, err := NewElasticsearchWriter(ElasticsearchConf{})
+	assert.EqualError(t, err, "elasticsearch: no url")
+	_, err = NewElasticsearchWriter(ElasticsearchConf{URL: "http://es", DeadLetter: filepath.Join(t.TempDir(), "x", "y")})
+	assert.ErrorContains(t, err, "elasticsearch: dead letter")
+}
+
+func TestLogConf_elasticsearch(t *testing.T) {
+	es := newFakeCluster(t)
+	c := NewDefaultLogger("", "info", WithElasticsearch(ElasticsearchConf{URL: es.URL, ECS: true, BatchWait: time.Hour}))
+	c.Stdout, c.Fileout = false, false
+	l := c.GetOceanLog()
+
+	l.Info("via conf")
+	assert.NoError(t, l.Flush())
+	if docs := es.documents(); assert.Len(t, docs, 1) {
+		assert.Equal(t, "via conf", docs[0].doc["message"])
+		assert.Contains(t, docs[0].doc, "log.origin.file.name")
+	}
+}
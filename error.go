@@ -0,0 +1,187 @@
+package oceanlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Field names of the error attached with WithError or CtxErrorw, following the Elastic Common Schema.
+const (
+	ErrorMessageFieldName    = "error.message"
+	ErrorTypeFieldName       = "error.type"
+	ErrorChainFieldName      = "error.chain"
+	ErrorStackTraceFieldName = "error.stack_trace"
+)
+
+type errorKey struct{}
+
+// contextWithError returns a context carrying err for the hooks, see TraceHook.
+func contextWithError(ctx context.Context, err error) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, errorKey{}, err)
+}
+
+// ErrorFromContext returns the error of the record being logged, for hooks reading e.GetCtx().
+func ErrorFromContext(ctx context.Context) (error, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	err, ok := ctx.Value(errorKey{}).(error)
+	return err, ok
+}
+
+// WithError returns a logger whose records carry err. Like Named, it has its own level and output.
+func (l *DefaultLogger) WithError(err error) *DefaultLogger {
+	c := l.current().derive()
+	c.err = err
+	return c
+}
+
+// CtxErrorw logs msg at error level with err and the key/value pairs fields.
+func (l *DefaultLogger) CtxErrorw(ctx context.Context, err error, msg string, fields ...interface{}) {
+	l.CtxLogw(LevelError, ctx, err, msg, fields...)
+}
+
+// CtxLogw logs msg at level with err and the key/value pairs fields.
+func (l *DefaultLogger) CtxLogw(level Level, ctx context.Context, err error, msg string, fields ...interface{}) {
+	l = l.current()
+	zl := l.ctxLogger(level, ctx)
+	l.newEvent(&zl, level, ctx, err).Fields(fields).Msg(msg)
+	if level == LevelFatal {
+		l.exit()
+	}
+}
+
+// errorFields adds the message, type, cause chain and stack trace of err to e.
+// When no error of the chain carries a stack, the stack of the caller is captured if capture is set.
+func errorFields(e *zerolog.Event, err error, capture bool) *zerolog.Event {
+	if e == nil || err == nil {
+		return e
+	}
+	e = e.Str(ErrorMessageFieldName, err.Error()).Str(ErrorTypeFieldName, errorType(err))
+
+	var pcs []uintptr
+	causes := zerolog.Arr()
+	n := 0
+	walkErrors(err, func(cause error, depth int) {
+		if pcs == nil {
+			pcs = errorStack(cause)
+		}
+		if depth > 0 {
+			causes.Dict(zerolog.Dict().Str("message", cause.Error()).Str("type", errorType(cause)))
+			n++
+		}
+	})
+	if n > 0 {
+		e = e.Array(ErrorChainFieldName, causes)
+	}
+	if pcs == nil && capture {
+		pcs = callers()
+	}
+	if len(pcs) > 0 {
+		e = e.Str(ErrorStackTraceFieldName, formatStack(pcs))
+	}
+	return e
+}
+
+func errorType(err error) string {
+	return fmt.Sprintf("%T", err)
+}
+
+// walkErrors calls fn for err and, depth first, for every error wrapped with errors.Unwrap or errors.Join.
+func walkErrors(err error, fn func(err error, depth int)) {
+	var walk func(err error, depth int)
+	walk = func(err error, depth int) {
+		if err == nil || depth > 32 {
+			return
+		}
+		fn(err, depth)
+		switch x := err.(type) {
+		case interface{ Unwrap() error }:
+			walk(x.Unwrap(), depth+1)
+		case interface{ Unwrap() []error }:
+			for _, cause := range x.Unwrap() {
+				walk(cause, depth+1)
+			}
+		}
+	}
+	walk(err, 0)
+}
+
+// errorStack returns the stack carried by err: a Callers() []uintptr method, as github.com/go-errors/errors,
+// or a StackTrace() method returning uintptr frames, as github.com/pkg/errors.
+func errorStack(err error) []uintptr {
+	if x, ok := err.(interface{ Callers() []uintptr }); ok {
+		return x.Callers()
+	}
+	m := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+		return nil
+	}
+	out := m.Type().Out(0)
+	if out.Kind() != reflect.Slice || out.Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+	frames := m.Call(nil)[0]
+	pcs := make([]uintptr, frames.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(frames.Index(i).Uint())
+	}
+	return pcs
+}
+
+// callers returns the stack above the first frame outside zerolog and this module.
+func callers() []uintptr {
+	var pcs [64]uintptr
+	n := runtime.Callers(3, pcs[:])
+	for i, pc := range pcs[:n] {
+		fn := runtime.FuncForPC(pc - 1)
+		if fn == nil {
+			continue
+		}
+		file, _ := fn.FileLine(pc - 1)
+		internal := strings.HasPrefix(fn.Name(), zerologPkg) || internalFrame(fn.Name(), file)
+		if !internal {
+			return append([]uintptr(nil), pcs[i:n]...)
+		}
+	}
+	return nil
+}
+
+// formatStack formats pcs as "function\n\tfile:line" lines, like a panic.
+func formatStack(pcs []uintptr) string {
+	var sb strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		if f.Function != "" {
+			sb.WriteString(f.Function)
+			sb.WriteString("\n\t")
+			sb.WriteString(f.File)
+			sb.WriteByte(':')
+			sb.WriteString(strconv.Itoa(f.Line))
+			sb.WriteByte('\n')
+		}
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
+
+// recordedError returns the error the hooks record for a record: the logged error, or else the message.
+func recordedError(ctx context.Context, message string) error {
+	if err, ok := ErrorFromContext(ctx); ok {
+		return err
+	}
+	return errors.New(message)
+}
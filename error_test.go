@@ -0,0 +1,129 @@
+package oceanlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type errorLog struct {
+	Level      string `json:"level"`
+	Message    string `json:"message"`
+	UserID     int    `json:"user_id"`
+	ErrMessage string `json:"error.message"`
+	ErrType    string `json:"error.type"`
+	Chain      []struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error.chain"`
+	Stack string `json:"error.stack_trace"`
+}
+
+func decodeErrorLog(t *testing.T, b *bytes.Buffer) errorLog {
+	var lo errorLog
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &lo))
+	return lo
+}
+
+func TestCtxErrorw(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := New(WithOutput(b))
+
+	cause := &fs.PathError{Op: "open", Path: "/etc/app.conf", Err: fs.ErrNotExist}
+	err := fmt.Errorf("load config: %w", errors.Join(cause, errors.New("fallback failed")))
+	l.CtxErrorw(context.Background(), err, "startup failed", "user_id", 42)
+
+	lo := decodeErrorLog(t, b)
+	assert.Equal(t, "error", lo.Level)
+	assert.Equal(t, "startup failed", lo.Message)
+	assert.Equal(t, 42, lo.UserID)
+	assert.Equal(t, err.Error(), lo.ErrMessage)
+	assert.Equal(t, "*fmt.wrapError", lo.ErrType)
+	if assert.Len(t, lo.Chain, 4) {
+		assert.Equal(t, "*errors.joinError", lo.Chain[0].Type)
+		assert.Equal(t, "*fs.PathError", lo.Chain[1].Type)
+		assert.Equal(t, "file does not exist", lo.Chain[2].Message)
+		assert.Equal(t, "fallback failed", lo.Chain[3].Message)
+	}
+	assert.Empty(t, lo.Stack)
+}
+
+func TestWithError(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := New(WithOutput(b), WithoutCaller())
+
+	l.WithError(errors.New("boom")).Warn("retrying")
+	lo := decodeErrorLog(t, b)
+	assert.Equal(t, "warn", lo.Level)
+	assert.Equal(t, "boom", lo.ErrMessage)
+	assert.Equal(t, "*errors.errorString", lo.ErrType)
+	assert.Nil(t, lo.Chain)
+
+	// the parent logger is unchanged
+	b.Reset()
+	l.Info("ok")
+	assert.Equal(t, "{\"level\":\"info\",\"message\":\"ok\"}\n", b.String())
+}
+
+type stackError struct {
+	pcs []uintptr
+}
+
+func (e *stackError) Error() string      { return "stack" }
+func (e *stackError) Callers() []uintptr { return e.pcs }
+
+func TestErrorStack(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := New(WithOutput(b))
+
+	l.CtxErrorw(context.Background(), errors.New("boom"), "failed")
+	assert.Empty(t, decodeErrorLog(t, b).Stack)
+
+	// captured at log time
+	b.Reset()
+	l = New(WithOutput(b), WithErrorStack())
+	l.CtxErrorw(context.Background(), errors.New("boom"), "failed")
+	stack := decodeErrorLog(t, b).Stack
+	assert.Contains(t, stack, "oceanlog.TestErrorStack\n")
+	assert.NotContains(t, stack, "CtxErrorw")
+
+	// carried by the error
+	var pcs [8]uintptr
+	n := runtime.Callers(1, pcs[:])
+	b.Reset()
+	l.WithError(fmt.Errorf("wrapped: %w", &stackError{pcs: pcs[:n]})).Error("failed")
+	assert.Contains(t, decodeErrorLog(t, b).Stack, "oceanlog.TestErrorStack\n\t")
+}
+
+type recordingSpan struct {
+	noop.Span
+	errs []error
+}
+
+func (s *recordingSpan) IsRecording() bool { return true }
+
+func (s *recordingSpan) RecordError(err error, _ ...trace.EventOption) { s.errs = append(s.errs, err) }
+
+func TestTraceHook_recordsError(t *testing.T) {
+	span := &recordingSpan{}
+	ctx := trace.ContextWithSpan(context.Background(), span)
+	l := New(WithOutput(&bytes.Buffer{}))
+
+	err := fmt.Errorf("query: %w", fs.ErrPermission)
+	l.CtxErrorw(ctx, err, "failed")
+	l.CtxErrorf(ctx, "plain")
+
+	if assert.Len(t, span.errs, 2) {
+		assert.Same(t, err, span.errs[0])
+		assert.EqualError(t, span.errs[1], "plain")
+	}
+}
@@ -0,0 +1,135 @@
+package oceanlog
+
+import (
+	"context"
+	"sort"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/rs/zerolog"
+	"github.com/v-mars/oceanlog/internal/fieldmap"
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// ContextExtractor adds fields taken from the context of a record.
+// The extractors of a logger run in the order they were added, see WithContextExtractor.
+type ContextExtractor interface {
+	Extract(ctx context.Context) []Field
+}
+
+// Extract implements ContextExtractor.
+func (fn FieldsExtractor) Extract(ctx context.Context) []Field {
+	return fn(ctx)
+}
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a context carrying the request ID id. A nil ctx is taken as context.Background().
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID set by ContextWithRequestID.
+// For compatibility a string stored under ReqIDKey is returned as well.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return id, true
+	}
+	id, ok := ctx.Value(ReqIDKey).(string)
+	return id, ok
+}
+
+// RequestIDExtractor logs the request ID of the context as LogIDKey.
+func RequestIDExtractor() ContextExtractor {
+	return FieldsExtractor(func(ctx context.Context) []Field {
+		if id, ok := RequestIDFromContext(ctx); ok {
+			return []Field{{Key: LogIDKey, Value: id}}
+		}
+		return nil
+	})
+}
+
+// ContextFieldsExtractor logs the fields of ContextWithFields.
+func ContextFieldsExtractor() ContextExtractor {
+	return FieldsExtractor(contextFields)
+}
+
+// BaggageExtractor logs the given OpenTelemetry baggage members under their own key.
+// Without members every member of the baggage is logged, sorted by key.
+func BaggageExtractor(members ...string) ContextExtractor {
+	return FieldsExtractor(func(ctx context.Context) []Field {
+		bag := baggage.FromContext(ctx)
+		if bag.Len() == 0 {
+			return nil
+		}
+		var fields []Field
+		if len(members) == 0 {
+			for _, m := range bag.Members() {
+				fields = append(fields, Field{Key: m.Key(), Value: m.Value()})
+			}
+			sort.Slice(fields, func(i, j int) bool { return fields[i].Key < fields[j].Key })
+			return fields
+		}
+		for _, key := range members {
+			if m := bag.Member(key); m.Key() != "" {
+				fields = append(fields, Field{Key: key, Value: m.Value()})
+			}
+		}
+		return fields
+	})
+}
+
+type requestContextKey struct{}
+
+// ContextWithRequestContext returns a context carrying the Hertz request context c, for HertzExtractor.
+// The returned context must not be used once the handler returned, Hertz reuses c.
+func ContextWithRequestContext(ctx context.Context, c *app.RequestContext) context.Context {
+	return context.WithValue(ctx, requestContextKey{}, c)
+}
+
+// HertzExtractor logs values of the Hertz request context attached by ContextWithRequestContext
+// or RequestContextMiddleware. fields maps a key set with RequestContext.Set, or else a request
+// header such as "x-b3-traceid", to the logged field name. Fields are logged sorted by name.
+func HertzExtractor(fields map[string]string) ContextExtractor {
+	keys := fieldmap.SortedKeys(fields)
+	return FieldsExtractor(func(ctx context.Context) []Field {
+		c, ok := ctx.Value(requestContextKey{}).(*app.RequestContext)
+		if !ok || c == nil {
+			return nil
+		}
+		var out []Field
+		for _, key := range keys {
+			if v, ok := c.Get(key); ok {
+				out = append(out, Field{Key: fields[key], Value: v})
+			} else if h := c.Request.Header.Get(key); h != "" {
+				out = append(out, Field{Key: fields[key], Value: h})
+			}
+		}
+		return out
+	})
+}
+
+// extractorHook runs the extractors for every record with a context. A key extracted several times
+// is logged once, at its first position with the value of the last extractor.
+func extractorHook(chain []ContextExtractor) zerolog.HookFunc {
+	return func(e *zerolog.Event, level zerolog.Level, message string) {
+		ctx := e.GetCtx()
+		if level == zerolog.Disabled || ctx == nil {
+			return
+		}
+		var fields []Field
+		for _, x := range chain {
+			for _, f := range x.Extract(ctx) {
+				fields = setField(fields, f.Key, f.Value)
+			}
+		}
+		for _, f := range fields {
+			e.Interface(f.Key, f.Value)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package oceanlog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/baggage"
+)
+
+func TestRequestIDExtractor(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b), WithoutCaller())
+
+	l.CtxInfof(ContextWithRequestID(context.Background(), "typed"), "typed")
+	l.CtxInfof(context.WithValue(context.Background(), ReqIDKey, "legacy"), "legacy")
+
+	assert.Equal(t, []string{
+		`{"level":"info","request_id":"typed","message":"typed"}`,
+		`{"level":"info","request_id":"legacy","message":"legacy"}`,
+	}, b.Lines())
+}
+
+func TestBaggageExtractor(t *testing.T) {
+	tenant, _ := baggage.NewMember("tenant", "acme")
+	region, _ := baggage.NewMember("region", "eu")
+	bag, _ := baggage.New(tenant, region)
+	ctx := baggage.ContextWithBaggage(context.Background(), bag)
+
+	b := &syncBuffer{}
+	New(WithOutput(b), WithContextExtractor(BaggageExtractor()), WithoutCaller()).CtxInfof(ctx, "all")
+	New(WithOutput(b), WithContextExtractor(BaggageExtractor("tenant", "missing")), WithoutCaller()).CtxInfof(ctx, "selected")
+
+	assert.Equal(t, []string{
+		`{"level":"info","region":"eu","tenant":"acme","message":"all"}`,
+		`{"level":"info","tenant":"acme","message":"selected"}`,
+	}, b.Lines())
+}
+
+func TestHertzExtractor(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b), WithContextExtractor(HertzExtractor(map[string]string{
+		"x-b3-traceid": "b3_trace_id",
+		"tenant":       "tenant",
+	})), WithoutCaller())
+
+	engine := route.NewEngine(config.NewOptions(nil))
+	engine.Use(RequestContextMiddleware())
+	engine.GET("/", func(ctx context.Context, c *app.RequestContext) {
+		c.Set("tenant", "acme")
+		l.CtxInfof(ContextWithRequestID(ctx, "req-1"), "handled")
+	})
+
+	ut.PerformRequest(engine, "GET", "/", nil, ut.Header{Key: "X-B3-TraceId", Value: "463ac35c9f6413ad"})
+
+	assert.Equal(t, []string{
+		`{"level":"info","request_id":"req-1","b3_trace_id":"463ac35c9f6413ad","tenant":"acme","message":"handled"}`,
+	}, b.Lines())
+}
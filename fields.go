@@ -0,0 +1,70 @@
+package oceanlog
+
+import (
+	"context"
+	"fmt"
+)
+
+// Field is a key/value pair attached to the records logged with a context.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// FieldsExtractor returns the fields a package wants to log for ctx, see WithContextExtractor.
+type FieldsExtractor func(ctx context.Context) []Field
+
+type contextFieldsKey struct{}
+
+// ContextWithFields returns a context carrying the key/value pairs kvs, e.g.
+// ContextWithFields(ctx, "user_id", 42, "tenant", "acme").
+// The fields of the parent context are kept, keys given again replace the parent's value.
+// A nil ctx is taken as context.Background().
+func ContextWithFields(ctx context.Context, kvs ...interface{}) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	parent := contextFields(ctx)
+	fields := make([]Field, len(parent), len(parent)+(len(kvs)+1)/2)
+	copy(fields, parent)
+
+	for i := 0; i < len(kvs); i += 2 {
+		key, ok := kvs[i].(string)
+		if !ok {
+			key = fmt.Sprint(kvs[i])
+		}
+		var value interface{}
+		if i+1 < len(kvs) {
+			value = kvs[i+1]
+		}
+		fields = setField(fields, key, value)
+	}
+	return context.WithValue(ctx, contextFieldsKey{}, fields)
+}
+
+func setField(fields []Field, key string, value interface{}) []Field {
+	for i := range fields {
+		if fields[i].Key == key {
+			fields[i].Value = value
+			return fields
+		}
+	}
+	return append(fields, Field{Key: key, Value: value})
+}
+
+func contextFields(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(contextFieldsKey{}).([]Field)
+	return fields
+}
+
+// FieldsFromContext returns the fields attached by ContextWithFields.
+func FieldsFromContext(ctx context.Context) map[string]interface{} {
+	fields := map[string]interface{}{}
+	for _, f := range contextFields(ctx) {
+		fields[f.Key] = f.Value
+	}
+	return fields
+}
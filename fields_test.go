@@ -0,0 +1,49 @@
+package oceanlog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextWithFields(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b), WithoutCaller())
+
+	ctx := ContextWithFields(context.Background(), "user_id", 42, "tenant", "acme")
+	child := ContextWithFields(ctx, "route", "/users", "tenant", "other")
+
+	l.CtxInfof(ctx, "parent")
+	l.CtxInfof(child, "child")
+	zl := l.Unwrap()
+	zl.Info().Ctx(child).Msg("zerolog")
+	l.Info("no context")
+
+	assert.Equal(t, []string{
+		`{"level":"info","user_id":42,"tenant":"acme","message":"parent"}`,
+		`{"level":"info","user_id":42,"tenant":"other","route":"/users","message":"child"}`,
+		`{"level":"info","user_id":42,"tenant":"other","route":"/users","message":"zerolog"}`,
+		`{"level":"info","message":"no context"}`,
+	}, b.Lines())
+	assert.Equal(t, map[string]interface{}{"user_id": 42, "tenant": "acme"}, FieldsFromContext(ctx))
+}
+
+func TestContextWithFields_nil(t *testing.T) {
+	ctx := ContextWithFields(nil, "user_id", 1)
+	assert.Equal(t, map[string]interface{}{"user_id": 1}, FieldsFromContext(ctx))
+}
+
+func TestContextExtractor_duplicateKeys(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b), WithContextExtractor(FieldsExtractor(func(ctx context.Context) []Field {
+		return []Field{{Key: "tenant", Value: "extracted"}, {Key: LogIDKey, Value: "extracted"}}
+	})), WithoutCaller())
+	ctx := ContextWithFields(ContextWithRequestID(context.Background(), "req-1"), "tenant", "acme", "user_id", 1)
+
+	l.CtxInfof(ctx, "once")
+
+	assert.Equal(t, []string{
+		`{"level":"info","request_id":"extracted","tenant":"extracted","user_id":1,"message":"once"}`,
+	}, b.Lines())
+}
@@ -0,0 +1,416 @@
+package oceanlog
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var _ zerolog.LevelWriter = (*FluentWriter)(nil)
+
+// Fluentd Forward protocol modes.
+const (
+	// FluentMessage sends one [tag, time, record, option] message per record.
+	FluentMessage = "message"
+	// FluentForward sends [tag, [[time, record], ...], option] messages.
+	FluentForward = "forward"
+	// FluentPackedForward sends [tag, bin([time, record]...), option] messages.
+	FluentPackedForward = "packed-forward"
+)
+
+// FluentConf configures a FluentWriter.
+type FluentConf struct {
+	Network       string        `json:"network"`        // tcp, the default, or unix
+	Addr          string        `json:"addr"`           // 127.0.0.1:24224 by default
+	Tag           string        `json:"tag"`            // tag prefix, "oceanlog" by default; named loggers add ".name"
+	Mode          string        `json:"mode"`           // FluentForward, the default, FluentMessage or FluentPackedForward
+	RequireAck    bool          `json:"require_ack"`    // wait for the server ack of every chunk, at-least-once delivery
+	AckTimeout    time.Duration `json:"ack_timeout"`    // 5s by default
+	BatchSize     int           `json:"batch_size"`     // records per chunk, 256 by default
+	FlushInterval time.Duration `json:"flush_interval"` // 200ms by default
+	BufferLimit   int           `json:"buffer_limit"`   // records kept while the server is unavailable, 8192 by default
+	MinBackoff    time.Duration `json:"min_backoff"`    // first reconnect delay, 100ms by default
+	MaxBackoff    time.Duration `json:"max_backoff"`    // 10s by default
+	Timeout       time.Duration `json:"timeout"`        // dial and write timeout, 5s by default
+}
+
+// FluentWriter sends JSON records to Fluentd or Fluent Bit with the Forward protocol.
+// Records are buffered and sent in the background; when the server is unavailable the writer
+// reconnects with backoff, keeping up to BufferLimit records and dropping the oldest ones beyond.
+type FluentWriter struct {
+	conf FluentConf
+
+	mu      sync.Mutex
+	now     func() time.Time
+	pending []fluentEntry
+	dropped int
+	closed  bool
+
+	// send serializes the chunks and guards conn
+	send sync.Mutex
+	conn net.Conn
+	dec  *msgpack.Decoder
+
+	full chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type fluentEntry struct {
+	tag string
+	// entry is the msgpack [time, record] pair
+	entry []byte
+}
+
+// NewFluentWriter returns a writer sending to the Forward server of conf. It connects on the first send.
+func NewFluentWriter(conf FluentConf) (*FluentWriter, error) {
+	if conf.Network == "" {
+		conf.Network = "tcp"
+	}
+	if conf.Addr == "" {
+		conf.Addr = "127.0.0.1:24224"
+	}
+	if conf.Tag == "" {
+		conf.Tag = "oceanlog"
+	}
+	if conf.Mode == "" {
+		conf.Mode = FluentForward
+	}
+	if conf.Mode != FluentMessage && conf.Mode != FluentForward && conf.Mode != FluentPackedForward {
+		return nil, fmt.Errorf("fluent: unknown mode %q", conf.Mode)
+	}
+	if conf.AckTimeout <= 0 {
+		conf.AckTimeout = 5 * time.Second
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 256
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = 200 * time.Millisecond
+	}
+	if conf.BufferLimit <= 0 {
+		conf.BufferLimit = 8192
+	}
+	if conf.MinBackoff <= 0 {
+		conf.MinBackoff = 100 * time.Millisecond
+	}
+	if conf.MaxBackoff <= 0 {
+		conf.MaxBackoff = 10 * time.Second
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 5 * time.Second
+	}
+
+	w := &FluentWriter{
+		conf: conf,
+		now:  time.Now,
+		full: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// SetClock sets the clock of the event times. By default, it is SystemClock.
+func (w *FluentWriter) SetClock(c Clock) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.now = c.Now
+}
+
+// Write implements io.Writer.
+func (w *FluentWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (w *FluentWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	record, t := fluentRecord(p, level)
+	tag := w.conf.Tag
+	if name, ok := record[LoggerFieldName].(string); ok && name != "" {
+		tag += "." + name
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, fmt.Errorf("fluent: writer closed")
+	}
+	var b bytes.Buffer
+	enc := msgpack.NewEncoder(&b)
+	_ = enc.EncodeArrayLen(2)
+	if t.IsZero() {
+		t = w.now()
+	}
+	encodeEventTime(enc, t)
+	if err := enc.Encode(record); err != nil {
+		return 0, err
+	}
+	w.pending = append(w.pending, fluentEntry{tag: tag, entry: b.Bytes()})
+	if len(w.pending) > w.conf.BufferLimit {
+		w.dropped += len(w.pending) - w.conf.BufferLimit
+		w.pending = w.pending[len(w.pending)-w.conf.BufferLimit:]
+	}
+	if len(w.pending) >= w.conf.BatchSize {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Flush sends the pending records. Records of a chunk that fails are kept for the next attempt.
+func (w *FluentWriter) Flush() error {
+	w.send.Lock()
+	defer w.send.Unlock()
+
+	entries, dropped := w.take()
+	if dropped > 0 {
+		log.Printf("fluent: dropped %d records, buffer limit %d reached", dropped, w.conf.BufferLimit)
+	}
+	for len(entries) > 0 {
+		chunk := fluentChunk(entries, w.conf.BatchSize)
+		if err := w.sendChunk(chunk); err != nil {
+			w.requeue(entries)
+			return err
+		}
+		entries = entries[len(chunk):]
+	}
+	return nil
+}
+
+// Close stops the writer, sends the pending records once and closes the connection.
+func (w *FluentWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.done)
+	w.wg.Wait()
+	err := w.Flush()
+	w.send.Lock()
+	defer w.send.Unlock()
+	w.disconnect()
+	return err
+}
+
+func (w *FluentWriter) run() {
+	defer w.wg.Done()
+	delay := w.conf.FlushInterval
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	full := w.full
+	for {
+		select {
+		case <-timer.C:
+		case <-full:
+		case <-w.done:
+			return
+		}
+		if err := w.Flush(); err != nil {
+			log.Println(err.Error())
+			// reconnect with backoff, full batches wait as well
+			if full = nil; delay < w.conf.MinBackoff {
+				delay = w.conf.MinBackoff
+			} else if delay *= 2; delay > w.conf.MaxBackoff {
+				delay = w.conf.MaxBackoff
+			}
+		} else {
+			full, delay = w.full, w.conf.FlushInterval
+		}
+		timer.Reset(delay)
+	}
+}
+
+// take returns the pending records and the number of records dropped since the last call.
+func (w *FluentWriter) take() ([]fluentEntry, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	entries, dropped := w.pending, w.dropped
+	w.pending, w.dropped = nil, 0
+	return entries, dropped
+}
+
+// requeue puts entries back before the records written meanwhile.
+func (w *FluentWriter) requeue(entries []fluentEntry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = append(entries, w.pending...)
+	if len(w.pending) > w.conf.BufferLimit {
+		w.dropped += len(w.pending) - w.conf.BufferLimit
+		w.pending = w.pending[len(w.pending)-w.conf.BufferLimit:]
+	}
+}
+
+// fluentChunk returns the first entries sharing the tag of entries[0], at most size.
+func fluentChunk(entries []fluentEntry, size int) []fluentEntry {
+	n := 1
+	for n < len(entries) && n < size && entries[n].tag == entries[0].tag {
+		n++
+	}
+	return entries[:n]
+}
+
+// sendChunk sends the entries of one tag, in one message unless in FluentMessage mode.
+func (w *FluentWriter) sendChunk(chunk []fluentEntry) error {
+	if w.conf.Mode == FluentMessage {
+		for _, e := range chunk {
+			if err := w.sendMessage(e.tag, func(enc *msgpack.Encoder) error {
+				// [time, record] without the array header
+				return enc.Encode(msgpack.RawMessage(e.entry[1:]))
+			}, 4); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return w.sendMessage(chunk[0].tag, func(enc *msgpack.Encoder) error {
+		if w.conf.Mode == FluentPackedForward {
+			var packed []byte
+			for _, e := range chunk {
+				packed = append(packed, e.entry...)
+			}
+			return enc.EncodeBytes(packed)
+		}
+		if err := enc.EncodeArrayLen(len(chunk)); err != nil {
+			return err
+		}
+		for _, e := range chunk {
+			if err := enc.Encode(msgpack.RawMessage(e.entry)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, 3)
+}
+
+// sendMessage writes the message [tag, entries..., option] of n elements and waits for the ack if required.
+func (w *FluentWriter) sendMessage(tag string, entries func(*msgpack.Encoder) error, n int) error {
+	var b bytes.Buffer
+	enc := msgpack.NewEncoder(&b)
+	_ = enc.EncodeArrayLen(n)
+	_ = enc.EncodeString(tag)
+	if err := entries(enc); err != nil {
+		return err
+	}
+	option := map[string]interface{}{}
+	var chunk string
+	if w.conf.RequireAck {
+		id := make([]byte, 16)
+		_, _ = rand.Read(id)
+		chunk = base64.StdEncoding.EncodeToString(id)
+		option["chunk"] = chunk
+	}
+	if err := enc.Encode(option); err != nil {
+		return err
+	}
+
+	if err := w.connect(); err != nil {
+		return err
+	}
+	_ = w.conn.SetWriteDeadline(time.Now().Add(w.conf.Timeout))
+	if _, err := w.conn.Write(b.Bytes()); err != nil {
+		w.disconnect()
+		return fmt.Errorf("fluent: %w", err)
+	}
+	if !w.conf.RequireAck {
+		return nil
+	}
+
+	_ = w.conn.SetReadDeadline(time.Now().Add(w.conf.AckTimeout))
+	var resp struct {
+		Ack string `msgpack:"ack"`
+	}
+	if err := w.dec.Decode(&resp); err != nil {
+		w.disconnect()
+		return fmt.Errorf("fluent: ack: %w", err)
+	}
+	if resp.Ack != chunk {
+		w.disconnect()
+		return fmt.Errorf("fluent: ack %q does not match chunk %q", resp.Ack, chunk)
+	}
+	return nil
+}
+
+func (w *FluentWriter) connect() error {
+	if w.conn != nil {
+		return nil
+	}
+	conn, err := net.DialTimeout(w.conf.Network, w.conf.Addr, w.conf.Timeout)
+	if err != nil {
+		return fmt.Errorf("fluent: %w", err)
+	}
+	w.conn = conn
+	w.dec = msgpack.NewDecoder(conn)
+	return nil
+}
+
+func (w *FluentWriter) disconnect() {
+	if w.conn != nil {
+		_ = w.conn.Close()
+		w.conn, w.dec = nil, nil
+	}
+}
+
+// encodeEventTime writes t as the EventTime extension: seconds and nanoseconds, big-endian uint32.
+func encodeEventTime(enc *msgpack.Encoder, t time.Time) {
+	var b [8]byte
+	binary.BigEndian.PutUint32(b[:4], uint32(t.Unix()))
+	binary.BigEndian.PutUint32(b[4:], uint32(t.Nanosecond()))
+	_ = enc.EncodeExtHeader(0, 8)
+	_ = enc.Encode(msgpack.RawMessage(b[:]))
+}
+
+// fluentRecord decodes the JSON record p, written at level, and its timestamp, zero if it has none.
+// Records that are not JSON objects become a message.
+func fluentRecord(p []byte, level zerolog.Level) (map[string]interface{}, time.Time) {
+	d := json.NewDecoder(bytes.NewReader(p))
+	d.UseNumber()
+	var record map[string]interface{}
+	if err := d.Decode(&record); err != nil || record == nil {
+		record = map[string]interface{}{zerolog.MessageFieldName: string(bytes.TrimRight(p, "\r\n"))}
+		if level != zerolog.NoLevel {
+			record[zerolog.LevelFieldName] = level.String()
+		}
+		return record, time.Time{}
+	}
+	t := recordTime(record[zerolog.TimestampFieldName])
+	return fluentValue(record).(map[string]interface{}), t
+}
+
+// fluentValue returns v with the JSON numbers converted to integers or floats.
+func fluentValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = fluentValue(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = fluentValue(e)
+		}
+	}
+	return v
+}
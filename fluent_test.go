@@ -0,0 +1,265 @@
+package oceanlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+type forwarded struct {
+	mode   string
+	tag    string
+	time   time.Time
+	record map[string]interface{}
+}
+
+// fakeForward is a Forward protocol server. It acks the chunks, unless dropping, in which case
+// it closes the connection of the messages it receives without acking them.
+type fakeForward struct {
+	ln       net.Listener
+	dropping atomic.Bool
+	messages atomic.Int32
+
+	mu     sync.Mutex
+	events []forwarded
+}
+
+func newFakeForward(t *testing.T) *fakeForward {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	f := &fakeForward{ln: ln}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(t, conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeForward) serve(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	dec := msgpack.NewDecoder(conn)
+	for {
+		events, option, err := decodeForward(dec)
+		if err != nil {
+			return
+		}
+		f.messages.Add(1)
+		if f.dropping.Load() {
+			return
+		}
+		f.mu.Lock()
+		f.events = append(f.events, events...)
+		f.mu.Unlock()
+		if chunk, ok := option["chunk"]; ok {
+			assert.NoError(t, msgpack.NewEncoder(conn).Encode(map[string]interface{}{"ack": chunk}))
+		}
+	}
+}
+
+func (f *fakeForward) received() []forwarded {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]forwarded(nil), f.events...)
+}
+
+func decodeForward(dec *msgpack.Decoder) ([]forwarded, map[string]interface{}, error) {
+	if _, err := dec.DecodeArrayLen(); err != nil {
+		return nil, nil, err
+	}
+	tag, err := dec.DecodeString()
+	if err != nil {
+		return nil, nil, err
+	}
+	var events []forwarded
+	c, _ := dec.PeekCode()
+	switch {
+	case msgpcode.IsFixedArray(c) || c == msgpcode.Array16 || c == msgpcode.Array32:
+		n, _ := dec.DecodeArrayLen()
+		for i := 0; i < n; i++ {
+			_, _ = dec.DecodeArrayLen()
+			events = append(events, decodeEvent(dec, FluentForward, tag))
+		}
+	case msgpcode.IsBin(c):
+		packed, _ := dec.DecodeBytes()
+		pdec := msgpack.NewDecoder(bytes.NewReader(packed))
+		for {
+			if _, err := pdec.DecodeArrayLen(); err != nil {
+				break
+			}
+			events = append(events, decodeEvent(pdec, FluentPackedForward, tag))
+		}
+	default:
+		events = append(events, decodeEvent(dec, FluentMessage, tag))
+	}
+	var option map[string]interface{}
+	err = dec.Decode(&option)
+	return events, option, err
+}
+
+func decodeEvent(dec *msgpack.Decoder, mode, tag string) forwarded {
+	e := forwarded{mode: mode, tag: tag}
+	if id, n, err := dec.DecodeExtHeader(); err == nil && id == 0 && n == 8 {
+		var b [8]byte
+		_ = dec.ReadFull(b[:])
+		e.time = time.Unix(int64(binary.BigEndian.Uint32(b[:4])), int64(binary.BigEndian.Uint32(b[4:])))
+	}
+	_ = dec.Decode(&e.record)
+	return e
+}
+
+func TestFluentWriter_modes(t *testing.T) {
+	for _, mode := range []string{FluentMessage, FluentForward, FluentPackedForward} {
+		t.Run(mode, func(t *testing.T) {
+			fwd := newFakeForward(t)
+			w, err := NewFluentWriter(FluentConf{Addr: fwd.ln.Addr().String(), Mode: mode, Tag: "app",
+				FlushInterval: time.Hour})
+			assert.NoError(t, err)
+			defer w.Close()
+			w.SetClock(syslogTime)
+			l := New(WithOutput(w), WithoutCaller())
+
+			l.Info("first")
+			l.Named("db").Warnf("slow %d", 3)
+			l.Named("db").Named("pool").Error("exhausted")
+			assert.NoError(t, w.Flush())
+
+			assert.Eventually(t, func() bool { return len(fwd.received()) == 3 }, time.Second, time.Millisecond)
+			events := fwd.received()
+			for _, e := range events {
+				assert.Equal(t, mode, e.mode)
+				assert.True(t, time.Time(syslogTime).Equal(e.time))
+			}
+			assert.Equal(t, "app", events[0].tag)
+			assert.Equal(t, map[string]interface{}{"level": "info", "message": "first"}, events[0].record)
+			assert.Equal(t, "app.db", events[1].tag)
+			assert.Equal(t, "db", events[1].record["logger"])
+			assert.Equal(t, "app.db.pool", events[2].tag)
+		})
+	}
+}
+
+func TestFluentWriter_values(t *testing.T) {
+	fwd := newFakeForward(t)
+	w, err := NewFluentWriter(FluentConf{Addr: fwd.ln.Addr().String(), FlushInterval: time.Hour})
+	assert.NoError(t, err)
+	defer w.Close()
+
+	zl := New(WithOutput(w)).Unwrap()
+	zl.Info().Int("n", 42).Float64("ratio", 0.5).Interface("tags", []string{"a"}).Msg("values")
+	_, _ = w.Write([]byte("plain text\n"))
+	assert.NoError(t, w.Flush())
+
+	assert.Eventually(t, func() bool { return len(fwd.received()) == 2 }, time.Second, time.Millisecond)
+	events := fwd.received()
+	assert.EqualValues(t, 42, events[0].record["n"])
+	assert.Equal(t, 0.5, events[0].record["ratio"])
+	assert.Equal(t, []interface{}{"a"}, events[0].record["tags"])
+	assert.Equal(t, map[string]interface{}{"message": "plain text"}, events[1].record)
+}
+
+func TestFluentWriter_ack(t *testing.T) {
+	fwd := newFakeForward(t)
+	w, err := NewFluentWriter(FluentConf{Addr: fwd.ln.Addr().String(), RequireAck: true,
+		AckTimeout: 100 * time.Millisecond, FlushInterval: time.Hour})
+	assert.NoError(t, err)
+	defer w.Close()
+	l := New(WithOutput(w))
+
+	// the server closes the connection without acking, the records are kept
+	fwd.dropping.Store(true)
+	l.Info("kept")
+	assert.Error(t, w.Flush())
+	assert.Empty(t, fwd.received())
+
+	// the writer reconnects and sends them again
+	fwd.dropping.Store(false)
+	l.Info("next")
+	assert.NoError(t, w.Flush())
+	events := fwd.received()
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, "kept", events[0].record["message"])
+		assert.Equal(t, "next", events[1].record["message"])
+	}
+	assert.Equal(t, int32(2), fwd.messages.Load())
+}
+
+func TestFluentWriter_buffer(t *testing.T) {
+	// nothing listens yet
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	w, err := NewFluentWriter(FluentConf{Addr: addr, BufferLimit: 2, FlushInterval: time.Hour})
+	assert.NoError(t, err)
+	defer w.Close()
+	l := New(WithOutput(w))
+	for _, msg := range []string{"1", "2", "3"} {
+		l.Info(msg)
+	}
+	assert.Error(t, w.Flush())
+
+	// the server comes up, the newest records are delivered
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip("address reused:", err)
+	}
+	fwd := &fakeForward{ln: ln}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			fwd.serve(t, conn)
+		}
+	}()
+	assert.NoError(t, w.Flush())
+	assert.Eventually(t, func() bool { return len(fwd.received()) == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, "2", fwd.received()[0].record["message"])
+}
+
+func TestFluentWriter_background(t *testing.T) {
+	fwd := newFakeForward(t)
+	w, err := NewFluentWriter(FluentConf{Addr: fwd.ln.Addr().String(), FlushInterval: 10 * time.Millisecond})
+	assert.NoError(t, err)
+	defer w.Close()
+
+	New(WithOutput(w)).Info("background")
+	assert.Eventually(t, func() bool { return len(fwd.received()) == 1 }, time.Second, time.Millisecond)
+}
+
+func TestFluentWriter_conf(t *testing.T) {
+	_, err := NewFluentWriter(FluentConf{Mode: "batch"})
+	assert.EqualError(t, err, `fluent: unknown mode "batch"`)
+}
+
+func TestLogConf_fluent(t *testing.T) {
+	fwd := newFakeForward(t)
+	c := NewDefaultLogger("", "info", WithFluent(FluentConf{Addr: fwd.ln.Addr().String(), FlushInterval: time.Hour}))
+	c.Stdout, c.Fileout = false, false
+	l := c.GetOceanLog()
+
+	l.Info("via conf")
+	assert.NoError(t, l.Flush())
+	assert.Eventually(t, func() bool { return len(fwd.received()) == 1 }, time.Second, time.Millisecond)
+}
+
+func TestDefaultLogger_Named(t *testing.T) {
+	l := New(WithName("app"))
+	assert.Equal(t, "app", l.Name())
+	assert.Equal(t, "app.db", l.Named("db").Name())
+	assert.Equal(t, "db", New().Named("db").Name())
+}
@@ -2,7 +2,7 @@ package oceanlog
 
 import (
 	"context"
-	"fmt"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
 	"io"
 )
 
@@ -57,32 +57,16 @@ type FullLogger interface {
 // Level defines the priority of a log message.
 // When a logs is configured with a level, any log message with a lower
 // log level (smaller by integer comparison) will not be output.
-type Level int
+// It is an alias of hlog.Level so that DefaultLogger satisfies hlog.FullLogger.
+type Level = hlog.Level
 
 // The levels of logs.
 const (
-	LevelTrace Level = iota
-	LevelDebug
-	LevelInfo
-	LevelNotice
-	LevelWarn
-	LevelError
-	LevelFatal
+	LevelTrace  = hlog.LevelTrace
+	LevelDebug  = hlog.LevelDebug
+	LevelInfo   = hlog.LevelInfo
+	LevelNotice = hlog.LevelNotice
+	LevelWarn   = hlog.LevelWarn
+	LevelError  = hlog.LevelError
+	LevelFatal  = hlog.LevelFatal
 )
-
-var strs = []string{
-	"[Trace] ",
-	"[Debug] ",
-	"[Info] ",
-	"[Notice] ",
-	"[Warn] ",
-	"[Error] ",
-	"[Fatal] ",
-}
-
-func (lv Level) toString() string {
-	if lv >= LevelTrace && lv <= LevelFatal {
-		return strs[lv]
-	}
-	return fmt.Sprintf("[?%d] ", lv)
-}
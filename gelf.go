@@ -0,0 +1,281 @@
+package oceanlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var _ zerolog.LevelWriter = (*GELFWriter)(nil)
+
+// GELF compressions of the UDP transport.
+const (
+	GELFGzip = "gzip"
+	GELFZlib = "zlib"
+	GELFNone = "none"
+)
+
+const (
+	// DefaultGELFChunkSize fits the datagrams in a WAN MTU.
+	DefaultGELFChunkSize = 1420
+	gelfMaxChunks        = 128
+	gelfChunkHeader      = 12
+)
+
+// GELFConf configures a GELFWriter.
+type GELFConf struct {
+	Network     string `json:"network"`     // udp, the default, or tcp
+	Addr        string `json:"addr"`        // graylog:12201
+	Host        string `json:"host"`        // host field, os.Hostname by default
+	Compression string `json:"compression"` // GELFGzip, the default, GELFZlib or GELFNone; tcp messages are not compressed
+	ChunkSize   int    `json:"chunk_size"`  // maximum datagram size, DefaultGELFChunkSize by default
+}
+
+// GELFWriter writes JSON records as GELF 1.1 messages to Graylog. The fields become additional fields
+// prefixed with "_", the levels syslog levels, and the error stacks of Error records go to full_message.
+// A failed write reconnects and retries once.
+type GELFWriter struct {
+	conf   GELFConf
+	stream bool
+
+	mu   sync.Mutex
+	now  func() time.Time
+	conn net.Conn
+}
+
+// NewGELFWriter connects to the GELF input of conf.
+func NewGELFWriter(conf GELFConf) (*GELFWriter, error) {
+	if conf.Network == "" {
+		conf.Network = "udp"
+	}
+	if conf.Compression == "" {
+		conf.Compression = GELFGzip
+	}
+	if conf.Compression != GELFGzip && conf.Compression != GELFZlib && conf.Compression != GELFNone {
+		return nil, fmt.Errorf("gelf: unknown compression %q", conf.Compression)
+	}
+	if conf.Host == "" {
+		conf.Host, _ = os.Hostname()
+	}
+	if conf.ChunkSize <= gelfChunkHeader {
+		conf.ChunkSize = DefaultGELFChunkSize
+	}
+
+	w := &GELFWriter{
+		conf:   conf,
+		stream: !strings.HasPrefix(conf.Network, "udp"),
+		now:    time.Now,
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// SetClock sets the clock of the message timestamps. By default, it is SystemClock.
+func (w *GELFWriter) SetClock(c Clock) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.now = c.Now
+}
+
+func (w *GELFWriter) connect() error {
+	if w.conn != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	conn, err := net.DialTimeout(w.conf.Network, w.conf.Addr, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("gelf: %w", err)
+	}
+	w.conn = conn
+	return nil
+}
+
+// Write implements io.Writer.
+func (w *GELFWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (w *GELFWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	msg, err := json.Marshal(w.message(parseRecord(p, level)))
+	if err != nil {
+		return 0, err
+	}
+	if w.conn != nil {
+		if err := w.send(msg); err == nil {
+			return len(p), nil
+		}
+	}
+	if err := w.connect(); err != nil {
+		return 0, err
+	}
+	if err := w.send(msg); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the connection.
+func (w *GELFWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// send writes msg null-terminated on streams, compressed and chunked in datagrams otherwise.
+func (w *GELFWriter) send(msg []byte) error {
+	if w.stream {
+		_, err := w.conn.Write(append(msg, 0))
+		return err
+	}
+	msg, err := w.compress(msg)
+	if err != nil {
+		return err
+	}
+	if len(msg) <= w.conf.ChunkSize {
+		_, err := w.conn.Write(msg)
+		return err
+	}
+
+	size := w.conf.ChunkSize - gelfChunkHeader
+	count := (len(msg) + size - 1) / size
+	if count > gelfMaxChunks {
+		return fmt.Errorf("gelf: message of %d bytes exceeds %d chunks", len(msg), gelfMaxChunks)
+	}
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	chunk := make([]byte, 0, w.conf.ChunkSize)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(msg) {
+			end = len(msg)
+		}
+		// magic bytes, message id, sequence number and count
+		chunk = append(chunk[:0], 0x1e, 0x0f)
+		chunk = append(chunk, id[:]...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, msg[i*size:end]...)
+		if _, err := w.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *GELFWriter) compress(msg []byte) ([]byte, error) {
+	var b bytes.Buffer
+	switch w.conf.Compression {
+	case GELFGzip:
+		zw := gzip.NewWriter(&b)
+		if _, err := zw.Write(msg); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	case GELFZlib:
+		zw := zlib.NewWriter(&b)
+		if _, err := zw.Write(msg); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return msg, nil
+	}
+	return b.Bytes(), nil
+}
+
+var gelfFieldName = regexp.MustCompile(`[^\w.\-]`)
+
+// message returns the GELF message of r.
+func (w *GELFWriter) message(r record) map[string]interface{} {
+	severity, ok := syslogSeverities[r.level]
+	if !ok {
+		severity = syslogSeverities["info"]
+	}
+	t := r.timeOr(w.now)
+	msg := map[string]interface{}{
+		"version":   "1.1",
+		"host":      w.conf.Host,
+		"timestamp": float64(t.UnixMicro()) / 1e6,
+		"level":     severity,
+	}
+
+	full := r.message
+	for _, f := range r.fields {
+		// the stack of Error records is shown with the message
+		if (f.key == ErrorStackTraceFieldName || f.key == zerolog.ErrorStackFieldName) &&
+			severity <= syslogSeverities["error"] {
+			full += "\n\n" + f.String()
+			continue
+		}
+		gelfFields(msg, "_"+gelfFieldName.ReplaceAllString(f.key, "_"), f.value)
+	}
+
+	short := r.message
+	if i := strings.IndexByte(short, '\n'); i >= 0 {
+		short = short[:i]
+	}
+	if short == "" {
+		short = "-"
+	}
+	msg["short_message"] = short
+	if full != "" && full != short {
+		msg["full_message"] = full
+	}
+	return msg
+}
+
+// gelfFields adds value under name, the members of objects under name_member. GELF values are
+// strings or numbers: other values are added as JSON text.
+func gelfFields(msg map[string]interface{}, name string, value json.RawMessage) {
+	if name == "_id" {
+		// reserved by Graylog
+		name = "_id_"
+	}
+	if len(value) == 0 {
+		return
+	}
+	switch value[0] {
+	case '{':
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(value, &obj) == nil {
+			for k, v := range obj {
+				gelfFields(msg, name+"_"+gelfFieldName.ReplaceAllString(k, "_"), v)
+			}
+			return
+		}
+	case '"':
+		msg[name] = recordField{value: value}.String()
+		return
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		msg[name] = json.Number(value)
+		return
+	}
+	msg[name] = string(value)
+}
@@ -0,0 +1,186 @@
+package oceanlog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readGELF reads one GELF message from conn, reassembling the chunks and decompressing it.
+func readGELF(t *testing.T, conn net.PacketConn) map[string]interface{} {
+	var chunks [][]byte
+	for {
+		p := readPacket(t, conn)
+		if len(p) < 2 || p[0] != 0x1e || p[1] != 0x0f {
+			return decodeGELF(t, []byte(p))
+		}
+		if chunks == nil {
+			chunks = make([][]byte, p[11])
+		}
+		chunks[p[10]] = []byte(p[12:])
+		complete := true
+		for _, c := range chunks {
+			complete = complete && c != nil
+		}
+		if complete {
+			return decodeGELF(t, bytes.Join(chunks, nil))
+		}
+	}
+}
+
+func decodeGELF(t *testing.T, p []byte) map[string]interface{} {
+	var r io.Reader = bytes.NewReader(p)
+	switch {
+	case bytes.HasPrefix(p, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(r)
+		assert.NoError(t, err)
+		r = zr
+	case p[0] == 0x78:
+		zr, err := zlib.NewReader(r)
+		assert.NoError(t, err)
+		r = zr
+	}
+	msg := map[string]interface{}{}
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	assert.NoError(t, d.Decode(&msg))
+	return msg
+}
+
+func TestGELFWriter_udp(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	w, err := NewGELFWriter(GELFConf{Addr: conn.LocalAddr().String(), Host: "host"})
+	assert.NoError(t, err)
+	defer w.Close()
+	w.SetClock(syslogTime)
+	l := New(WithOutput(w), WithoutCaller()).WithField("user", map[string]interface{}{"id": 42, "name": "alice"})
+
+	l.CtxNoticef(ContextWithRequestID(context.Background(), "r1"), "slow\nquery took %dms", 1200)
+	assert.Equal(t, map[string]interface{}{
+		"version":       "1.1",
+		"host":          "host",
+		"timestamp":     json.Number("1714979289.123456"),
+		"level":         json.Number("5"),
+		"short_message": "slow",
+		"full_message":  "slow\nquery took 1200ms",
+		"_user_id":      json.Number("42"),
+		"_user_name":    "alice",
+		"_request_id":   "r1",
+	}, readGELF(t, conn))
+}
+
+func TestGELFWriter_errorStack(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	w, err := NewGELFWriter(GELFConf{Addr: conn.LocalAddr().String(), Compression: GELFZlib})
+	assert.NoError(t, err)
+	defer w.Close()
+	l := New(WithOutput(w), WithErrorStack())
+
+	l.CtxErrorw(context.Background(), errors.New("boom"), "failed", "id", "o-1", "ok", false)
+	msg := readGELF(t, conn)
+	assert.Equal(t, json.Number("3"), msg["level"])
+	assert.Equal(t, "failed", msg["short_message"])
+	assert.True(t, strings.HasPrefix(msg["full_message"].(string), "failed\n\n"))
+	assert.Contains(t, msg["full_message"], "TestGELFWriter_errorStack")
+	assert.NotContains(t, msg, "_error.stack_trace")
+	assert.Equal(t, "boom", msg["_error.message"])
+	assert.Equal(t, "o-1", msg["_id_"])
+	assert.Equal(t, "false", msg["_ok"])
+
+	// only Error records carry the stack in full_message
+	l.WithError(errors.New("retry")).Warn("retrying")
+	msg = readGELF(t, conn)
+	assert.NotContains(t, msg, "full_message")
+	assert.Contains(t, msg, "_error.stack_trace")
+}
+
+func TestGELFWriter_chunks(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	w, err := NewGELFWriter(GELFConf{Addr: conn.LocalAddr().String(), Compression: GELFNone, ChunkSize: 200})
+	assert.NoError(t, err)
+	defer w.Close()
+
+	long := strings.Repeat("0123456789", 100)
+	New(WithOutput(w)).Info(long)
+	assert.Equal(t, long, readGELF(t, conn)["short_message"])
+
+	_, err = w.Write([]byte(strings.Repeat("x", 200*gelfMaxChunks)))
+	assert.ErrorContains(t, err, "exceeds 128 chunks")
+}
+
+func TestGELFWriter_tcp(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	msgs := make(chan string, 4)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			msg, err := r.ReadString(0)
+			if err != nil {
+				return
+			}
+			msgs <- msg
+		}
+	}()
+
+	w, err := NewGELFWriter(GELFConf{Network: "tcp", Addr: ln.Addr().String()})
+	assert.NoError(t, err)
+	defer w.Close()
+	l := New(WithOutput(w))
+	l.Info("first")
+	l.Warn("second")
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case msg := <-msgs:
+			assert.True(t, strings.HasSuffix(msg, "\x00"))
+			assert.Equal(t, want, decodeGELF(t, []byte(strings.TrimSuffix(msg, "\x00")))["short_message"])
+		case <-time.After(time.Second):
+			t.Fatal("no message")
+		}
+	}
+}
+
+func TestGELFWriter_conf(t *testing.T) {
+	_, err := NewGELFWriter(GELFConf{Addr: "127.0.0.1:12201", Compression: "brotli"})
+	assert.EqualError(t, err, `gelf: unknown compression "brotli"`)
+}
+
+func TestLogConf_gelf(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	c := NewDefaultLogger("", "info", WithGELF(GELFConf{Addr: conn.LocalAddr().String()}))
+	c.Stdout, c.Fileout = false, false
+	c.GetOceanLog().Info("via conf")
+	msg := readGELF(t, conn)
+	assert.Equal(t, "via conf", msg["short_message"])
+	assert.Contains(t, msg, "_caller")
+}
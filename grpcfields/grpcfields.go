@@ -0,0 +1,30 @@
+// Package grpcfields logs gRPC metadata through oceanlog context extractors.
+package grpcfields
+
+import (
+	"context"
+
+	"github.com/v-mars/oceanlog"
+	"github.com/v-mars/oceanlog/internal/fieldmap"
+	"google.golang.org/grpc/metadata"
+)
+
+// MetadataExtractor logs values of the incoming gRPC metadata of the context.
+// fields maps a metadata key such as "x-b3-traceid" to the logged field name.
+// Fields are logged sorted by name, keys with several values log the first one.
+func MetadataExtractor(fields map[string]string) oceanlog.ContextExtractor {
+	keys := fieldmap.SortedKeys(fields)
+	return oceanlog.FieldsExtractor(func(ctx context.Context) []oceanlog.Field {
+		md, ok := metadata.FromIncomingContext(ctx)
+		if !ok {
+			return nil
+		}
+		var out []oceanlog.Field
+		for _, key := range keys {
+			if v := md.Get(key); len(v) > 0 {
+				out = append(out, oceanlog.Field{Key: fields[key], Value: v[0]})
+			}
+		}
+		return out
+	})
+}
@@ -0,0 +1,35 @@
+package grpcfields
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/v-mars/oceanlog"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestMetadataExtractor(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := oceanlog.New(
+		oceanlog.WithoutCaller(),
+		oceanlog.WithOutput(b),
+		oceanlog.WithContextExtractor(MetadataExtractor(map[string]string{
+			"x-b3-traceid": "b3_trace_id",
+			"x-tenant":     "tenant",
+		})),
+	)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"X-B3-TraceId", "463ac35c9f6413ad",
+		"x-tenant", "acme",
+		"x-other", "ignored",
+	))
+
+	l.CtxInfof(ctx, "rpc")
+	l.CtxInfof(context.Background(), "no metadata")
+
+	assert.Equal(t, `{"level":"info","b3_trace_id":"463ac35c9f6413ad","tenant":"acme","message":"rpc"}
+{"level":"info","message":"no metadata"}
+`, b.String())
+}
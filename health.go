@@ -0,0 +1,283 @@
+package oceanlog
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	_ zerolog.LevelWriter = (*SinkWriter)(nil)
+	_ zerolog.LevelWriter = (*FallbackWriter)(nil)
+)
+
+// ErrCircuitOpen is returned by the writes to a SinkWriter whose circuit is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// Circuit states of a SinkWriter.
+const (
+	CircuitClosed   = "closed"    // records are written
+	CircuitOpen     = "open"      // records are refused until the cooldown ends
+	CircuitHalfOpen = "half_open" // a trial write decides whether the circuit closes
+)
+
+// BreakerConf configures the circuit breaker of a SinkWriter.
+type BreakerConf struct {
+	Threshold int           `json:"threshold"` // consecutive failures opening the circuit, 5 by default
+	Cooldown  time.Duration `json:"cooldown"`  // delay before a trial write, 30s by default
+}
+
+// WriteErrorHandler is called with the record a sink failed to write.
+type WriteErrorHandler func(sink string, err error, p []byte)
+
+// SinkHealth is the health of a sink.
+type SinkHealth struct {
+	Name          string    `json:"name"`
+	State         string    `json:"state"`   // Circuit*
+	Healthy       bool      `json:"healthy"` // closed circuit and last write succeeded
+	Failures      int       `json:"consecutive_failures"`
+	Writes        uint64    `json:"writes"`
+	Errors        uint64    `json:"errors"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorTime time.Time `json:"last_error_time,omitzero"`
+}
+
+// SinkWriter is a named sink behind a circuit breaker. After Threshold consecutive failures, the circuit
+// opens and the writes fail fast with ErrCircuitOpen, so that a fallback can take over; after the cooldown,
+// one trial write closes the circuit again or reopens it.
+type SinkWriter struct {
+	name string
+	w    io.Writer
+	conf BreakerConf
+
+	mu        sync.Mutex
+	now       func() time.Time
+	onError   WriteErrorHandler
+	metrics   Metrics
+	state     string
+	failures  int
+	openedAt  time.Time
+	writes    uint64
+	errs      uint64
+	lastErr   error
+	lastErrAt time.Time
+}
+
+// NewSinkWriter returns the sink name writing to w.
+func NewSinkWriter(name string, w io.Writer, conf BreakerConf) *SinkWriter {
+	if conf.Threshold <= 0 {
+		conf.Threshold = 5
+	}
+	if conf.Cooldown <= 0 {
+		conf.Cooldown = 30 * time.Second
+	}
+	return &SinkWriter{name: name, w: w, conf: conf, now: time.Now, state: CircuitClosed}
+}
+
+// SetClock sets the clock of the cooldown. By default, it is SystemClock.
+func (s *SinkWriter) SetClock(c Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = c.Now
+}
+
+// SetErrorHandler sets the function called when a write fails. It is not called for ErrCircuitOpen.
+func (s *SinkWriter) SetErrorHandler(h WriteErrorHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onError = h
+}
+
+// SetMetrics sets the metrics receiving the writes of the sink.
+func (s *SinkWriter) SetMetrics(m Metrics) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = m
+}
+
+// Name returns the name of the sink.
+func (s *SinkWriter) Name() string {
+	return s.name
+}
+
+// Write implements io.Writer.
+func (s *SinkWriter) Write(p []byte) (int, error) {
+	return s.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (s *SinkWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	s.mu.Lock()
+	switch {
+	case s.state == CircuitOpen && s.now().Sub(s.openedAt) >= s.conf.Cooldown:
+		s.state = CircuitHalfOpen
+	case s.state != CircuitClosed:
+		// open, or half open with the trial write in progress
+		metrics := s.metrics
+		s.mu.Unlock()
+		if metrics != nil {
+			metrics.Dropped(s.name, "circuit_open")
+		}
+		return 0, ErrCircuitOpen
+	}
+	metrics := s.metrics
+	s.mu.Unlock()
+
+	start := time.Now()
+	var n int
+	var err error
+	if lw, ok := s.w.(zerolog.LevelWriter); ok {
+		n, err = lw.WriteLevel(level, p)
+	} else {
+		n, err = s.w.Write(p)
+	}
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	if metrics != nil {
+		metrics.SinkWrite(s.name, n, time.Since(start), err)
+	}
+
+	s.mu.Lock()
+	s.writes++
+	if err == nil {
+		if s.state != CircuitClosed {
+			log.Printf("oceanlog: sink %s recovered", s.name)
+		}
+		s.state, s.failures = CircuitClosed, 0
+		s.mu.Unlock()
+		return n, nil
+	}
+	s.errs++
+	s.failures++
+	s.lastErr, s.lastErrAt = err, s.now()
+	if s.state == CircuitHalfOpen || s.failures >= s.conf.Threshold {
+		if s.state == CircuitClosed {
+			log.Printf("oceanlog: sink %s failed %d times, circuit open: %v", s.name, s.failures, err)
+		}
+		s.state, s.openedAt = CircuitOpen, s.now()
+	}
+	onError := s.onError
+	s.mu.Unlock()
+
+	if onError != nil {
+		onError(s.name, err, p)
+	}
+	return n, err
+}
+
+// Health returns the health of the sink.
+func (s *SinkWriter) Health() SinkHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := SinkHealth{
+		Name:          s.name,
+		State:         s.state,
+		Healthy:       s.state == CircuitClosed && s.failures == 0,
+		Failures:      s.failures,
+		Writes:        s.writes,
+		Errors:        s.errs,
+		LastErrorTime: s.lastErrAt,
+	}
+	if s.lastErr != nil {
+		h.LastError = s.lastErr.Error()
+	}
+	return h
+}
+
+// Flush flushes the sink if it has a Flush() error method.
+func (s *SinkWriter) Flush() error {
+	if f, ok := s.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close closes the sink if it is an io.Closer.
+func (s *SinkWriter) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// FallbackWriter writes each record to the first of its sinks that accepts it, e.g. a file, then stderr.
+// A sink whose circuit is open is skipped until its cooldown ends.
+type FallbackWriter struct {
+	sinks []*SinkWriter
+}
+
+// NewFallbackWriter returns a chain of sinks, tried in order.
+func NewFallbackWriter(sinks ...*SinkWriter) *FallbackWriter {
+	return &FallbackWriter{sinks: sinks}
+}
+
+// Write implements io.Writer.
+func (f *FallbackWriter) Write(p []byte) (int, error) {
+	return f.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter. It fails when every sink failed.
+func (f *FallbackWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	var errs []error
+	for _, s := range f.sinks {
+		n, err := s.WriteLevel(level, p)
+		if err == nil {
+			return n, nil
+		}
+		errs = append(errs, err)
+	}
+	return 0, errors.Join(errs...)
+}
+
+// Sinks returns the sinks of the chain.
+func (f *FallbackWriter) Sinks() []*SinkWriter {
+	return f.sinks
+}
+
+// Health returns the health of the sinks of the chain.
+func (f *FallbackWriter) Health() []SinkHealth {
+	health := make([]SinkHealth, len(f.sinks))
+	for i, s := range f.sinks {
+		health[i] = s.Health()
+	}
+	return health
+}
+
+// HealthHandler returns an http.Handler reporting the health of sinks as JSON, e.g. LogConf.Health.
+// The status is "ok" when every sink is healthy, "degraded" when some are not, and "down" with a
+// 503 Service Unavailable when none is.
+func HealthHandler(sinks func() []SinkHealth) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := sinks()
+		healthy := 0
+		for _, h := range health {
+			if h.Healthy {
+				healthy++
+			}
+		}
+		status, code := "ok", http.StatusOK
+		switch {
+		case healthy == len(health):
+		case healthy > 0:
+			status = "degraded"
+		default:
+			status, code = "down", http.StatusServiceUnavailable
+		}
+		if health == nil {
+			health = []SinkHealth{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(struct {
+			Status string       `json:"status"`
+			Sinks  []SinkHealth `json:"sinks"`
+		}{status, health})
+	})
+}
@@ -0,0 +1,166 @@
+package oceanlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSinkWriter(t *testing.T) {
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	sink := &flakySink{down: true}
+	s := NewSinkWriter("remote", sink, BreakerConf{Threshold: 2, Cooldown: time.Minute})
+	s.SetClock(ClockFunc(func() time.Time { return now }))
+	var failed []string
+	s.SetErrorHandler(func(name string, err error, p []byte) {
+		failed = append(failed, name+": "+err.Error()+": "+string(p))
+	})
+
+	_, err := s.Write([]byte("a"))
+	assert.EqualError(t, err, "sink down")
+	assert.Equal(t, CircuitClosed, s.Health().State)
+	assert.False(t, s.Health().Healthy)
+	_, err = s.Write([]byte("b"))
+	assert.EqualError(t, err, "sink down")
+	assert.Equal(t, CircuitOpen, s.Health().State)
+
+	// the open circuit fails fast
+	_, err = s.Write([]byte("c"))
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, []string{"remote: sink down: a", "remote: sink down: b"}, failed)
+
+	// a failed trial write reopens the circuit
+	now = now.Add(time.Minute)
+	_, err = s.Write([]byte("d"))
+	assert.EqualError(t, err, "sink down")
+	_, err = s.Write([]byte("e"))
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	// a successful one closes it
+	sink.setDown(false)
+	now = now.Add(time.Minute)
+	_, err = s.Write([]byte("f"))
+	assert.NoError(t, err)
+	assert.Equal(t, SinkHealth{Name: "remote", State: CircuitClosed, Healthy: true, Writes: 4, Errors: 3,
+		LastError: "sink down", LastErrorTime: now.Add(-time.Minute)}, s.Health())
+	assert.Equal(t, []string{"f"}, sink.written())
+}
+
+func TestFallbackWriter(t *testing.T) {
+	primary := &flakySink{down: true}
+	var secondary bytes.Buffer
+	f := NewFallbackWriter(NewSinkWriter("primary", primary, BreakerConf{Threshold: 1}),
+		NewSinkWriter("secondary", &secondary, BreakerConf{}))
+	l := New(WithOutput(f))
+
+	l.Info("first")
+	l.Info("second")
+	assert.Contains(t, secondary.String(), `"message":"first"`)
+	assert.Contains(t, secondary.String(), `"message":"second"`)
+	health := f.Health()
+	assert.Equal(t, CircuitOpen, health[0].State)
+	// the open primary is skipped
+	assert.Equal(t, uint64(1), health[0].Writes)
+	assert.True(t, health[1].Healthy)
+
+	// every sink failed
+	f = NewFallbackWriter(NewSinkWriter("primary", primary, BreakerConf{}))
+	_, err := f.Write([]byte("lost"))
+	assert.EqualError(t, err, "sink down")
+}
+
+func TestHealthHandler(t *testing.T) {
+	var health []SinkHealth
+	h := HealthHandler(func() []SinkHealth { return health })
+	get := func() (int, map[string]interface{}) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		var body map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return rec.Code, body
+	}
+
+	code, body := get()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"status": "ok", "sinks": []interface{}{}}, body)
+
+	health = []SinkHealth{{Name: "file", State: CircuitOpen, LastError: "disk full"}, {Name: "stderr", Healthy: true}}
+	code, body = get()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "degraded", body["status"])
+	assert.Equal(t, "disk full", body["sinks"].([]interface{})[0].(map[string]interface{})["last_error"])
+
+	health = health[:1]
+	code, body = get()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "down", body["status"])
+}
+
+func TestLogConf_healthShared(t *testing.T) {
+	c := NewDefaultLogger(filepath.Join(t.TempDir(), "app.log"), "info",
+		WithJournald(JournaldConf{Socket: filepath.Join(t.TempDir(), "none"), Fallback: io.Discard}))
+	c.Stdout = false
+	c.GetOceanLog().Info("first")
+	c.GetLogrusLog().Info("second")
+	_ = c.GetHzLog(context.Background())
+
+	var names []string
+	for _, h := range c.Health() {
+		names = append(names, h.Name)
+	}
+	assert.Equal(t, []string{"file", "stderr", "journald"}, names)
+}
+
+func TestLogConf_healthCopied(t *testing.T) {
+	c := NewDefaultLogger(filepath.Join(t.TempDir(), "app.log"), "info",
+		WithJournald(JournaldConf{Socket: filepath.Join(t.TempDir(), "none"), Fallback: io.Discard}))
+	c.Stdout, c.Fileout = false, false
+
+	// the copy made before the first logger shares the health of c
+	copied := *c
+	c.GetOceanLog().Info("started")
+	if health := copied.Health(); assert.Len(t, health, 1) {
+		assert.Equal(t, "journald", health[0].Name)
+	}
+}
+
+func TestLogConf_fallback(t *testing.T) {
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	dir := t.TempDir()
+	var failed []string
+	c := NewDefaultLogger(filepath.Join(dir, "app.log"), "info")
+	c.Stdout, c.Formatter = false, logJson
+	c.OnWriteError = func(sink string, err error, p []byte) { failed = append(failed, sink) }
+	// the log file cannot be created below a regular file
+	c.Lumberjack.Filename = filepath.Join(dir, "app.log", "app.log")
+	l := c.GetOceanLog()
+
+	l.Info("to stderr")
+	assert.NoError(t, w.Close())
+	out, _ := io.ReadAll(r)
+	assert.Contains(t, string(out), `"message":"to stderr"`)
+	assert.Equal(t, []string{"file"}, failed)
+
+	health := c.Health()
+	if assert.Len(t, health, 2) {
+		assert.Equal(t, "file", health[0].Name)
+		assert.False(t, health[0].Healthy)
+		assert.Contains(t, health[0].LastError, "app.log")
+		assert.True(t, health[1].Healthy)
+	}
+}
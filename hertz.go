@@ -0,0 +1,57 @@
+package oceanlog
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/utils"
+)
+
+// DebugBufferMiddleware buffers the Trace and Debug records of each request, see WithDebugBuffer.
+// They are written when the handler responds with a 5xx status or attaches an error to the
+// request context, and dropped otherwise.
+func DebugBufferMiddleware(maxRecords, maxBytes int) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		ctx = WithDebugBuffer(ctx, maxRecords, maxBytes)
+		c.Next(ctx)
+
+		if c.Response.StatusCode() >= 500 || len(c.Errors) > 0 {
+			FlushDebugBuffer(ctx)
+			return
+		}
+		DiscardDebugBuffer(ctx)
+	}
+}
+
+// RequestContextMiddleware attaches the Hertz request context to ctx for HertzExtractor.
+func RequestContextMiddleware() app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		c.Next(ContextWithRequestContext(ctx, c))
+	}
+}
+
+// RecoveryMiddleware logs the panics of the handlers with l, or the default logger if l is nil, see Recover,
+// and responds with a 500 status and a JSON body carrying the request ID.
+// The request ID is taken from the context, see ContextWithRequestID, or else from the ReqIDKey header.
+func RecoveryMiddleware(l *DefaultLogger, options ...RecoverOpt) app.HandlerFunc {
+	opts := newRecoverOptions(options)
+	return func(ctx context.Context, c *app.RequestContext) {
+		id, ok := RequestIDFromContext(ctx)
+		if !ok {
+			if id = string(c.Request.Header.Peek(ReqIDKey)); id != "" {
+				ctx = ContextWithRequestID(ctx, id)
+			}
+		}
+		defer func() {
+			if v := recover(); v != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, utils.H{
+					"error":  http.StatusText(http.StatusInternalServerError),
+					LogIDKey: id,
+				})
+				handlePanic(ctx, l, v, opts)
+			}
+		}()
+		c.Next(ctx)
+	}
+}
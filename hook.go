@@ -1,7 +1,6 @@
 package oceanlog
 
 import (
-	"errors"
 	"github.com/rs/zerolog"
 	"go.opentelemetry.io/otel/codes"
 	"strings"
@@ -39,7 +38,7 @@ func (h *TraceHook) Levels() []zerolog.Level {
 }
 
 func (h *TraceHook) Run(e *zerolog.Event, level zerolog.Level, message string) {
-	if e.GetCtx() == nil {
+	if level == zerolog.Disabled || e.GetCtx() == nil {
 		return
 	}
 
@@ -60,15 +59,18 @@ func (h *TraceHook) Run(e *zerolog.Event, level zerolog.Level, message string) {
 	span.AddEvent(logEventKey, trace.WithAttributes(attrs...))
 
 	// set span status
-	if level >= h.cfg.errorSpanLevel {
+	if level >= h.cfg.errorSpanLevel && level != noticeLevel {
 		span.SetStatus(codes.Error, message)
-		span.RecordError(errors.New(message), trace.WithStackTrace(h.cfg.recordStackTraceInSpan))
+		span.RecordError(recordedError(e.GetCtx(), message), trace.WithStackTrace(h.cfg.recordStackTraceInSpan))
 	}
 
 	return
 }
 
 func OtelSeverityText(lv zerolog.Level) string {
+	if lv == noticeLevel {
+		return strings.ToUpper(LevelNoticeValue)
+	}
 	s := lv.String()
 	//if s == "warning" {
 	//	s = "warn"
@@ -0,0 +1,19 @@
+// Package fieldmap helps the context extractors mapping keys to logged field names.
+package fieldmap
+
+import "sort"
+
+// SortedKeys returns the keys of m sorted by the field name they map to, then by key.
+func SortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] < m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
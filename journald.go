@@ -0,0 +1,204 @@
+package oceanlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+var _ zerolog.LevelWriter = (*JournaldWriter)(nil)
+
+// DefaultJournaldSocket is the native protocol socket of systemd-journald.
+const DefaultJournaldSocket = "/run/systemd/journal/socket"
+
+// JournaldConf configures a JournaldWriter.
+type JournaldConf struct {
+	// Socket defaults to DefaultJournaldSocket.
+	Socket string `json:"socket"`
+	// Identifier is the SYSLOG_IDENTIFIER, the program name by default.
+	Identifier string `json:"identifier"`
+	// Fallback receives the records unchanged when there is no journal socket, os.Stderr by default.
+	Fallback io.Writer `json:"-"`
+}
+
+// JournaldWriter writes JSON records to systemd-journald with the native protocol: MESSAGE, PRIORITY,
+// CODE_FILE and CODE_LINE from the caller, and the other fields flattened as uppercase journal fields,
+// e.g. TRACE_ID from TraceHook or ERROR_MESSAGE from WithError.
+type JournaldWriter struct {
+	conf JournaldConf
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+// NewJournaldWriter returns a writer sending to the journal socket of conf,
+// or to the fallback writer if the socket does not exist.
+func NewJournaldWriter(conf JournaldConf) *JournaldWriter {
+	if conf.Socket == "" {
+		conf.Socket = DefaultJournaldSocket
+	}
+	if conf.Identifier == "" {
+		conf.Identifier = basename(os.Args[0])
+	}
+	if conf.Fallback == nil {
+		conf.Fallback = os.Stderr
+	}
+	w := &JournaldWriter{conf: conf}
+	if _, err := os.Stat(conf.Socket); err == nil {
+		if conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: conf.Socket, Net: "unixgram"}); err == nil {
+			w.conn = conn
+		}
+	}
+	return w
+}
+
+// Journal reports whether the records are sent to the journal rather than the fallback writer.
+func (w *JournaldWriter) Journal() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.conn != nil
+}
+
+// Write implements io.Writer.
+func (w *JournaldWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (w *JournaldWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return w.conf.Fallback.Write(p)
+	}
+	if err := w.send(w.entry(parseRecord(p, level))); err != nil {
+		// the journal went away
+		return w.conf.Fallback.Write(p)
+	}
+	return len(p), nil
+}
+
+// Close closes the journal socket.
+func (w *JournaldWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// send writes one entry, passing it as a file descriptor if it is too large for a datagram.
+func (w *JournaldWriter) send(entry []byte) error {
+	_, err := w.conn.Write(entry)
+	if err != nil && isMessageTooLarge(err) {
+		return sendJournalFile(w.conn, entry)
+	}
+	return err
+}
+
+// entry returns the native protocol serialization of r.
+func (w *JournaldWriter) entry(r record) []byte {
+	var b bytes.Buffer
+	severity, ok := syslogSeverities[r.level]
+	if !ok {
+		severity = syslogSeverities["info"]
+	}
+	journalField(&b, "MESSAGE", r.message)
+	journalField(&b, "PRIORITY", string(rune('0'+severity)))
+	journalField(&b, "SYSLOG_IDENTIFIER", w.conf.Identifier)
+
+	fields := map[string]string{}
+	for _, f := range r.fields {
+		if f.key == zerolog.CallerFieldName {
+			if file, line, ok := splitCaller(f.String()); ok {
+				journalField(&b, "CODE_FILE", file)
+				journalField(&b, "CODE_LINE", line)
+				continue
+			}
+		}
+		flattenJournal(fields, journalName(f.key), f.value)
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		journalField(&b, k, fields[k])
+	}
+	return b.Bytes()
+}
+
+// flattenJournal adds value under name, the members of objects under NAME_MEMBER.
+func flattenJournal(fields map[string]string, name string, value json.RawMessage) {
+	if name == "" {
+		return
+	}
+	if len(value) > 0 && value[0] == '{' {
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(value, &obj) == nil {
+			for k, v := range obj {
+				flattenJournal(fields, journalName(name+"_"+k), v)
+			}
+			return
+		}
+	}
+	fields[name] = recordField{value: value}.String()
+}
+
+// journalName returns key as a journal field name: uppercase letters, digits and underscores,
+// not starting with an underscore or a digit, at most 64 bytes.
+func journalName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+	name = strings.TrimLeft(name, "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// journalField writes NAME=value, or the binary form for values containing a newline.
+func journalField(b *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteString(name)
+	b.WriteByte('\n')
+	_ = binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// splitCaller splits a "file:line" caller.
+func splitCaller(caller string) (file, line string, ok bool) {
+	i := strings.LastIndexByte(caller, ':')
+	if i <= 0 || i == len(caller)-1 {
+		return "", "", false
+	}
+	return caller[:i], caller[i+1:], true
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package oceanlog
+
+import (
+	"errors"
+	"net"
+)
+
+func isMessageTooLarge(err error) bool {
+	return false
+}
+
+func sendJournalFile(conn *net.UnixConn, entry []byte) error {
+	return errors.New("journald: passing entries as files is not supported")
+}
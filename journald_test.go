@@ -0,0 +1,158 @@
+//go:build unix
+
+package oceanlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracedSpan struct {
+	recordingSpan
+	sc trace.SpanContext
+}
+
+func (s *tracedSpan) SpanContext() trace.SpanContext { return s.sc }
+
+// fakeJournal listens on a unixgram socket and decodes the native protocol entries it receives.
+type fakeJournal struct {
+	path string
+	conn *net.UnixConn
+}
+
+func newFakeJournal(t *testing.T) *fakeJournal {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return &fakeJournal{path: path, conn: conn}
+}
+
+func (j *fakeJournal) read(t *testing.T) map[string]string {
+	buf := make([]byte, 64*1024)
+	oob := make([]byte, 64)
+	_ = j.conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, oobn, _, _, err := j.conn.ReadMsgUnix(buf, oob)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	data := buf[:n]
+	if oobn > 0 {
+		// the entry was passed as a file descriptor
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		assert.NoError(t, err)
+		fds, err := syscall.ParseUnixRights(&msgs[0])
+		assert.NoError(t, err)
+		f := os.NewFile(uintptr(fds[0]), "entry")
+		defer f.Close()
+		_, _ = f.Seek(0, 0)
+		var b bytes.Buffer
+		_, _ = b.ReadFrom(f)
+		data = b.Bytes()
+	}
+	return decodeJournalEntry(t, data)
+}
+
+func decodeJournalEntry(t *testing.T, data []byte) map[string]string {
+	fields := map[string]string{}
+	for len(data) > 0 {
+		i := bytes.IndexAny(data, "=\n")
+		if !assert.True(t, i > 0, "malformed entry") {
+			return fields
+		}
+		name := string(data[:i])
+		if data[i] == '=' {
+			end := bytes.IndexByte(data, '\n')
+			fields[name] = string(data[i+1 : end])
+			data = data[end+1:]
+			continue
+		}
+		size := binary.LittleEndian.Uint64(data[i+1 : i+9])
+		fields[name] = string(data[i+9 : i+9+int(size)])
+		data = data[i+9+int(size)+1:]
+	}
+	return fields
+}
+
+func TestJournaldWriter(t *testing.T) {
+	j := newFakeJournal(t)
+	w := NewJournaldWriter(JournaldConf{Socket: j.path, Identifier: "app"})
+	defer w.Close()
+	assert.True(t, w.Journal())
+	l := New(WithOutput(w), WithCaller()).WithField("user.id", 42)
+
+	l.Warnf("disk %d%%", 91)
+	fields := j.read(t)
+	assert.Equal(t, "disk 91%", fields["MESSAGE"])
+	assert.Equal(t, "4", fields["PRIORITY"])
+	assert.Equal(t, "app", fields["SYSLOG_IDENTIFIER"])
+	assert.Equal(t, "journald_test.go", fields["CODE_FILE"])
+	assert.NotEmpty(t, fields["CODE_LINE"])
+	assert.Equal(t, "42", fields["USER_ID"])
+	assert.NotContains(t, fields, "CALLER")
+
+	l.Notice("multi\nline")
+	fields = j.read(t)
+	assert.Equal(t, "multi\nline", fields["MESSAGE"])
+	assert.Equal(t, "5", fields["PRIORITY"])
+}
+
+func TestJournaldWriter_fields(t *testing.T) {
+	j := newFakeJournal(t)
+	w := NewJournaldWriter(JournaldConf{Socket: j.path})
+	defer w.Close()
+	l := New(WithOutput(w))
+
+	span := &tracedSpan{sc: trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67},
+		TraceFlags: trace.FlagsSampled,
+	})}
+	ctx := trace.ContextWithSpan(context.Background(), span)
+	zl := l.Unwrap()
+	zl.Error().Ctx(ctx).Interface("http", map[string]interface{}{"status": 500, "route": "/orders"}).
+		Msg("failed")
+
+	fields := j.read(t)
+	assert.Equal(t, "3", fields["PRIORITY"])
+	assert.Equal(t, span.sc.TraceID().String(), fields["TRACE_ID"])
+	assert.Equal(t, span.sc.SpanID().String(), fields["SPAN_ID"])
+	assert.Equal(t, "500", fields["HTTP_STATUS"])
+	assert.Equal(t, "/orders", fields["HTTP_ROUTE"])
+}
+
+func TestJournaldWriter_large(t *testing.T) {
+	j := newFakeJournal(t)
+	w := NewJournaldWriter(JournaldConf{Socket: j.path})
+	defer w.Close()
+
+	msg := strings.Repeat("x", 512*1024)
+	New(WithOutput(w)).Info(msg)
+	assert.Equal(t, msg, j.read(t)["MESSAGE"])
+}
+
+func TestJournaldWriter_fallback(t *testing.T) {
+	var b bytes.Buffer
+	w := NewJournaldWriter(JournaldConf{Socket: filepath.Join(t.TempDir(), "missing.sock"), Fallback: &b})
+	assert.False(t, w.Journal())
+
+	New(WithOutput(w)).Info("to stderr")
+	assert.Contains(t, b.String(), `"message":"to stderr"`)
+}
+
+func TestJournalName(t *testing.T) {
+	assert.Equal(t, "ERROR_MESSAGE", journalName("error.message"))
+	assert.Equal(t, "USER", journalName("_1user"))
+	assert.Equal(t, 64, len(journalName(strings.Repeat("a", 100))))
+}
@@ -0,0 +1,290 @@
+package oceanlog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var _ zerolog.LevelWriter = (*KafkaWriter)(nil)
+
+// ErrKafkaBufferFull is the delivery error of the records dropped because KafkaConf.MaxBuffer was reached.
+var ErrKafkaBufferFull = errors.New("kafka: buffer full")
+
+// KafkaMessage is a record to publish.
+type KafkaMessage struct {
+	Topic string
+	// Key is the value of the first KafkaConf.KeyFields field of the record, nil if it has none
+	Key   []byte
+	Value []byte
+	Time  time.Time
+}
+
+// KafkaProducer publishes messages to Kafka, e.g. the sarama producer of package kafkalog.
+type KafkaProducer interface {
+	// Produce publishes msgs and returns once the broker acknowledged them. When only some messages failed,
+	// it returns a *KafkaDeliveryError listing them.
+	Produce(ctx context.Context, msgs []KafkaMessage) error
+	Close() error
+}
+
+// KafkaDeliveryError lists the messages of a batch that were not delivered.
+type KafkaDeliveryError struct {
+	Failed []KafkaMessage
+	Err    error
+}
+
+func (e *KafkaDeliveryError) Error() string {
+	return fmt.Sprintf("kafka: %d messages not delivered: %v", len(e.Failed), e.Err)
+}
+
+func (e *KafkaDeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// Kafka compression codecs and acks, applied by the producer.
+const (
+	KafkaCompressionNone   = "none"
+	KafkaCompressionGzip   = "gzip"
+	KafkaCompressionSnappy = "snappy"
+	KafkaCompressionLZ4    = "lz4"
+	KafkaCompressionZstd   = "zstd"
+
+	KafkaAcksAll    = "all"
+	KafkaAcksLeader = "leader"
+	KafkaAcksNone   = "none"
+)
+
+// KafkaConf configures a KafkaWriter.
+type KafkaConf struct {
+	Brokers     []string `json:"brokers"`     // used by the producer
+	Topic       string   `json:"topic"`       //
+	ClientID    string   `json:"client_id"`   // used by the producer
+	Compression string   `json:"compression"` // KafkaCompression*, used by the producer, snappy by default
+	Acks        string   `json:"acks"`        // KafkaAcks*, used by the producer, all by default
+	// KeyFields are the fields whose first present value is the message key, e.g. trace_id and request_id,
+	// so that the records of a trace stay in one partition, in order. Without key, records are spread.
+	KeyFields []string      `json:"key_fields"`
+	BatchSize int           `json:"batch_size"` // records per Produce call, 500 by default
+	BatchWait time.Duration `json:"batch_wait"` // maximum delay of a record, 100ms by default
+	MaxBuffer int           `json:"max_buffer"` // records waiting for delivery, 100000 by default
+	Timeout   time.Duration `json:"timeout"`    // per Produce call, 30s by default
+
+	// Producer publishes the messages. Required.
+	Producer KafkaProducer `json:"-"`
+	// OnError is called with the messages that were not delivered. The records dropped because MaxBuffer
+	// was reached are reported by the write that dropped them, so it may be called concurrently.
+	OnError func(msgs []KafkaMessage, err error) `json:"-"`
+	// Spill receives the records that were not delivered, e.g. a lumberjack file.
+	Spill io.Writer `json:"-"`
+}
+
+// KafkaWriter publishes JSON records to a Kafka topic, batching them in the background.
+//
+// Delivery is at most once from the writer's point of view: a record is handed to the producer once, which
+// retries according to its own configuration. Records that are not delivered, because the producer failed
+// or because MaxBuffer was reached, are passed to OnError and written to Spill, so none is lost silently;
+// records still buffered when the process crashes are lost. Use KafkaAcksAll to survive broker failures.
+type KafkaWriter struct {
+	conf KafkaConf
+
+	mu      sync.Mutex
+	now     func() time.Time
+	pending []KafkaMessage
+	closed  bool
+
+	// send serializes the Produce calls
+	send sync.Mutex
+	full chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewKafkaWriter returns a writer publishing to the topic of conf with conf.Producer.
+func NewKafkaWriter(conf KafkaConf) (*KafkaWriter, error) {
+	if conf.Producer == nil {
+		return nil, fmt.Errorf("kafka: no producer")
+	}
+	if conf.Topic == "" {
+		return nil, fmt.Errorf("kafka: no topic")
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 500
+	}
+	if conf.BatchWait <= 0 {
+		conf.BatchWait = 100 * time.Millisecond
+	}
+	if conf.MaxBuffer <= 0 {
+		conf.MaxBuffer = 100000
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 30 * time.Second
+	}
+
+	w := &KafkaWriter{
+		conf: conf,
+		now:  time.Now,
+		full: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// SetClock sets the clock of the message times. By default, it is SystemClock.
+func (w *KafkaWriter) SetClock(c Clock) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.now = c.Now
+}
+
+// Write implements io.Writer.
+func (w *KafkaWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (w *KafkaWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	msg := KafkaMessage{Topic: w.conf.Topic, Value: append([]byte(nil), bytes.TrimRight(p, "\r\n")...)}
+	r := parseRecord(p, level)
+	if len(w.conf.KeyFields) > 0 {
+		msg.Key = w.key(r)
+	}
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return 0, fmt.Errorf("kafka: writer closed")
+	}
+	msg.Time = r.timeOr(w.now)
+	w.pending = append(w.pending, msg)
+	var dropped []KafkaMessage
+	if n := len(w.pending) - w.conf.MaxBuffer; n > 0 {
+		// reported now rather than kept until the next Flush, which may wait for Produce
+		dropped = append(dropped, w.pending[:n]...)
+		w.pending = w.pending[n:]
+	}
+	if len(w.pending) >= w.conf.BatchSize {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+	w.mu.Unlock()
+
+	w.failed(dropped, ErrKafkaBufferFull)
+	return len(p), nil
+}
+
+// key returns the value of the first key field of r.
+func (w *KafkaWriter) key(r record) []byte {
+	for _, name := range w.conf.KeyFields {
+		for _, f := range r.fields {
+			if f.key == name {
+				return []byte(f.String())
+			}
+		}
+	}
+	return nil
+}
+
+// Flush publishes the pending records.
+func (w *KafkaWriter) Flush() error {
+	w.send.Lock()
+	defer w.send.Unlock()
+
+	msgs := w.take()
+	var errs []error
+	for len(msgs) > 0 {
+		n := len(msgs)
+		if n > w.conf.BatchSize {
+			n = w.conf.BatchSize
+		}
+		if err := w.produce(msgs[:n]); err != nil {
+			errs = append(errs, err)
+		}
+		msgs = msgs[n:]
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops the writer, publishes the pending records and closes the producer.
+func (w *KafkaWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.done)
+	w.wg.Wait()
+	return errors.Join(w.Flush(), w.conf.Producer.Close())
+}
+
+func (w *KafkaWriter) run() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.conf.BatchWait)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.full:
+		case <-w.done:
+			return
+		}
+		// the delivery errors go to OnError and Spill
+		_ = w.Flush()
+	}
+}
+
+// take returns the pending messages.
+func (w *KafkaWriter) take() []KafkaMessage {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	pending := w.pending
+	w.pending = nil
+	return pending
+}
+
+func (w *KafkaWriter) produce(msgs []KafkaMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.conf.Timeout)
+	defer cancel()
+	err := w.conf.Producer.Produce(ctx, msgs)
+	if err == nil {
+		return nil
+	}
+	failed := msgs
+	var de *KafkaDeliveryError
+	if errors.As(err, &de) {
+		failed = de.Failed
+	}
+	w.failed(failed, err)
+	return err
+}
+
+// failed reports msgs to OnError and writes them to Spill.
+func (w *KafkaWriter) failed(msgs []KafkaMessage, err error) {
+	if len(msgs) == 0 {
+		return
+	}
+	if w.conf.OnError != nil {
+		w.conf.OnError(msgs, err)
+	} else if w.conf.Spill == nil {
+		log.Printf("kafka: dropped %d records: %v", len(msgs), err)
+	}
+	if w.conf.Spill != nil {
+		for _, m := range msgs {
+			_, _ = w.conf.Spill.Write(append(m.Value, '\n'))
+		}
+	}
+}
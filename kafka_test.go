@@ -0,0 +1,257 @@
+package oceanlog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBroker is an in-memory KafkaProducer. It partitions the messages by key like the default
+// partitioner and fails the ones whose value contains "fail".
+type fakeBroker struct {
+	partitions int
+
+	mu          sync.Mutex
+	logs        map[string][][]KafkaMessage // topic, partition
+	batches     []int
+	next        int // round robin partition of the messages without key
+	closed      bool
+	unavailable error
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{partitions: 4, logs: map[string][][]KafkaMessage{}}
+}
+
+func (b *fakeBroker) Produce(ctx context.Context, msgs []KafkaMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.unavailable != nil {
+		return b.unavailable
+	}
+	b.batches = append(b.batches, len(msgs))
+	var failed []KafkaMessage
+	for _, m := range msgs {
+		if bytes.Contains(m.Value, []byte("fail")) {
+			failed = append(failed, m)
+			continue
+		}
+		if b.logs[m.Topic] == nil {
+			b.logs[m.Topic] = make([][]KafkaMessage, b.partitions)
+		}
+		p := b.next % b.partitions
+		b.next++
+		if m.Key != nil {
+			h := fnv.New32a()
+			_, _ = h.Write(m.Key)
+			p = int(h.Sum32() % uint32(b.partitions))
+		}
+		b.logs[m.Topic][p] = append(b.logs[m.Topic][p], m)
+	}
+	if len(failed) > 0 {
+		return &KafkaDeliveryError{Failed: failed, Err: errors.New("message too large")}
+	}
+	return nil
+}
+
+func (b *fakeBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return nil
+}
+
+// messages returns the messages of topic, partition after partition.
+func (b *fakeBroker) messages(topic string) []KafkaMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var msgs []KafkaMessage
+	for _, p := range b.logs[topic] {
+		msgs = append(msgs, p...)
+	}
+	return msgs
+}
+
+// partition returns the partition of the messages with key.
+func (b *fakeBroker) partition(topic, key string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, p := range b.logs[topic] {
+		for _, m := range p {
+			if string(m.Key) == key {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func TestKafkaWriter(t *testing.T) {
+	broker := newFakeBroker()
+	w, err := NewKafkaWriter(KafkaConf{Topic: "logs", KeyFields: []string{"trace_id", "request_id"},
+		Producer: broker, BatchWait: time.Hour})
+	assert.NoError(t, err)
+	w.SetClock(syslogTime)
+	l := New(WithOutput(w))
+
+	ctx := ContextWithRequestID(context.Background(), "r1")
+	l.CtxLogw(LevelInfo, ctx, nil, "first", "trace_id", "t1")
+	l.CtxLogw(LevelInfo, ctx, nil, "second", "trace_id", "t1")
+	l.CtxInfof(ctx, "by request")
+	l.Info("no key")
+	assert.NoError(t, w.Flush())
+
+	msgs := broker.messages("logs")
+	if assert.Len(t, msgs, 4) {
+		keys := map[string][]string{}
+		for _, m := range msgs {
+			assert.Equal(t, syslogTime.Now(), m.Time)
+			assert.False(t, bytes.HasSuffix(m.Value, []byte("\n")))
+			keys[string(m.Key)] = append(keys[string(m.Key)], string(m.Value))
+		}
+		// the records of a trace keep their order in their partition
+		if assert.Len(t, keys["t1"], 2) {
+			assert.Contains(t, keys["t1"][0], `"message":"first"`)
+			assert.Contains(t, keys["t1"][1], `"message":"second"`)
+		}
+		assert.Len(t, keys["r1"], 1)
+		assert.Len(t, keys[""], 1)
+	}
+	assert.NotEqual(t, -1, broker.partition("logs", "t1"))
+
+	assert.NoError(t, w.Close())
+	assert.True(t, broker.closed)
+	_, err = w.Write([]byte("{}\n"))
+	assert.EqualError(t, err, "kafka: writer closed")
+}
+
+func TestKafkaWriter_deliveryError(t *testing.T) {
+	broker := newFakeBroker()
+	var spill bytes.Buffer
+	var failed []KafkaMessage
+	var failure error
+	w, err := NewKafkaWriter(KafkaConf{Topic: "logs", Producer: broker, BatchWait: time.Hour, Spill: &spill,
+		OnError: func(msgs []KafkaMessage, err error) {
+			failed = append(failed, msgs...)
+			failure = err
+		}})
+	assert.NoError(t, err)
+	defer w.Close()
+	l := New(WithOutput(w))
+
+	l.Info("delivered")
+	l.Info("fail me")
+	assert.ErrorContains(t, w.Flush(), "kafka: 1 messages not delivered: message too large")
+	assert.Len(t, broker.messages("logs"), 1)
+	if assert.Len(t, failed, 1) {
+		assert.Contains(t, string(failed[0].Value), "fail me")
+	}
+	var de *KafkaDeliveryError
+	assert.ErrorAs(t, failure, &de)
+	assert.Equal(t, 1, strings.Count(spill.String(), "\n"))
+	assert.Contains(t, spill.String(), `"message":"fail me"}`+"\n")
+
+	// the whole batch is spilled when the broker is unavailable
+	broker.mu.Lock()
+	broker.unavailable = errors.New("no leader")
+	broker.mu.Unlock()
+	l.Info("one")
+	l.Info("two")
+	assert.EqualError(t, w.Flush(), "no leader")
+	assert.Len(t, failed, 3)
+	assert.Equal(t, 3, strings.Count(spill.String(), "\n"))
+}
+
+func TestKafkaWriter_bounded(t *testing.T) {
+	broker := newFakeBroker()
+	var spill bytes.Buffer
+	var failure error
+	w, err := NewKafkaWriter(KafkaConf{Topic: "logs", Producer: broker, BatchWait: time.Hour, BatchSize: 100,
+		MaxBuffer: 3, Spill: &spill, OnError: func(_ []KafkaMessage, err error) { failure = err }})
+	assert.NoError(t, err)
+	defer w.Close()
+
+	l := New(WithOutput(w))
+	for i := 0; i < 5; i++ {
+		l.Infof("record %d", i)
+	}
+	// the oldest records are dropped to the spill by the writes, before the next Flush
+	assert.ErrorIs(t, failure, ErrKafkaBufferFull)
+	assert.Contains(t, spill.String(), "record 0")
+	assert.Contains(t, spill.String(), "record 1")
+	assert.NoError(t, w.Flush())
+	msgs := broker.messages("logs")
+	if assert.Len(t, msgs, 3) {
+		assert.Contains(t, string(msgs[0].Value), "record 2")
+	}
+}
+
+func TestKafkaWriter_batch(t *testing.T) {
+	broker := newFakeBroker()
+	w, err := NewKafkaWriter(KafkaConf{Topic: "logs", Producer: broker, BatchWait: time.Hour, BatchSize: 2})
+	assert.NoError(t, err)
+	defer w.Close()
+
+	l := New(WithOutput(w))
+	for i := 0; i < 5; i++ {
+		l.Infof("record %d", i)
+	}
+	// BatchSize triggers background batches of at most 2 records
+	assert.Eventually(t, func() bool { return len(broker.messages("logs")) >= 4 }, time.Second, time.Millisecond)
+	assert.NoError(t, w.Flush())
+	assert.Len(t, broker.messages("logs"), 5)
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	for _, n := range broker.batches {
+		assert.LessOrEqual(t, n, 2)
+	}
+}
+
+func TestKafkaWriter_conf(t *testing.T) {
+	_, err := NewKafkaWriter(KafkaConf{Topic: "logs"})
+	assert.EqualError(t, err, "kafka: no producer")
+	_, err = NewKafkaWriter(KafkaConf{Producer: newFakeBroker()})
+	assert.EqualError(t, err, "kafka: no topic")
+}
+
+func TestLogConf_kafka(t *testing.T) {
+	broker := newFakeBroker()
+	c := NewDefaultLogger("", "info", WithKafka(KafkaConf{Topic: "logs", Producer: broker, BatchWait: time.Hour}))
+	c.Stdout, c.Fileout = false, false
+	l := c.GetOceanLog()
+
+	l.Info("via conf")
+	assert.NoError(t, l.Flush())
+	if msgs := broker.messages("logs"); assert.Len(t, msgs, 1) {
+		assert.Contains(t, string(msgs[0].Value), `"message":"via conf"`)
+	}
+}
+
+func TestLogConf_kafkaSpill(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.log")
+	c := NewDefaultLogger(file, "info", WithKafka(KafkaConf{Topic: "logs", Producer: newFakeBroker(), BatchWait: time.Hour}))
+	c.Stdout, c.Formatter = false, logJson
+	l := c.GetOceanLog()
+
+	l.Info("delivered")
+	l.Info("failed delivery")
+	assert.Error(t, l.Flush())
+
+	// the log file has every record once, the spill the undelivered one
+	logged, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(logged), "failed delivery"))
+	spilled, err := os.ReadFile(file + ".kafka-undelivered")
+	assert.NoError(t, err)
+	assert.Contains(t, string(spilled), "failed delivery")
+	assert.NotContains(t, string(spilled), `"delivered"`)
+}
@@ -0,0 +1,114 @@
+// Package kafkalog provides the sarama producer of oceanlog.KafkaWriter.
+package kafkalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/IBM/sarama"
+	"github.com/v-mars/oceanlog"
+)
+
+var _ oceanlog.KafkaProducer = (*Producer)(nil)
+
+// Producer publishes oceanlog messages with a sarama SyncProducer.
+type Producer struct {
+	producer sarama.SyncProducer
+}
+
+// NewProducer connects to the brokers of conf. Messages are retried by sarama, 3 times by default,
+// and acknowledged according to conf.Acks.
+func NewProducer(conf oceanlog.KafkaConf) (*Producer, error) {
+	config, err := Config(conf)
+	if err != nil {
+		return nil, err
+	}
+	p, err := sarama.NewSyncProducer(conf.Brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+	return NewProducerFrom(p), nil
+}
+
+// NewProducerFrom returns a Producer publishing with p, e.g. a mocks.SyncProducer.
+func NewProducerFrom(p sarama.SyncProducer) *Producer {
+	return &Producer{producer: p}
+}
+
+// Config returns the sarama configuration of conf.
+func Config(conf oceanlog.KafkaConf) (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	// message timestamps and zstd
+	config.Version = sarama.V2_1_0_0
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	if conf.ClientID != "" {
+		config.ClientID = conf.ClientID
+	}
+	if conf.Timeout > 0 {
+		config.Producer.Timeout = conf.Timeout
+	}
+
+	switch conf.Compression {
+	case oceanlog.KafkaCompressionSnappy, "":
+		config.Producer.Compression = sarama.CompressionSnappy
+	case oceanlog.KafkaCompressionNone:
+		config.Producer.Compression = sarama.CompressionNone
+	case oceanlog.KafkaCompressionGzip:
+		config.Producer.Compression = sarama.CompressionGZIP
+	case oceanlog.KafkaCompressionLZ4:
+		config.Producer.Compression = sarama.CompressionLZ4
+	case oceanlog.KafkaCompressionZstd:
+		config.Producer.Compression = sarama.CompressionZSTD
+	default:
+		return nil, fmt.Errorf("kafka: unknown compression %q", conf.Compression)
+	}
+
+	switch conf.Acks {
+	case oceanlog.KafkaAcksAll, "":
+		config.Producer.RequiredAcks = sarama.WaitForAll
+	case oceanlog.KafkaAcksLeader:
+		config.Producer.RequiredAcks = sarama.WaitForLocal
+	case oceanlog.KafkaAcksNone:
+		config.Producer.RequiredAcks = sarama.NoResponse
+	default:
+		return nil, fmt.Errorf("kafka: unknown acks %q", conf.Acks)
+	}
+	return config, config.Validate()
+}
+
+// Produce implements oceanlog.KafkaProducer. A failure of some messages returns an *oceanlog.KafkaDeliveryError.
+func (p *Producer) Produce(ctx context.Context, msgs []oceanlog.KafkaMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	pms := make([]*sarama.ProducerMessage, len(msgs))
+	index := make(map[*sarama.ProducerMessage]int, len(msgs))
+	for i, m := range msgs {
+		pm := &sarama.ProducerMessage{Topic: m.Topic, Value: sarama.ByteEncoder(m.Value), Timestamp: m.Time}
+		if m.Key != nil {
+			pm.Key = sarama.ByteEncoder(m.Key)
+		}
+		pms[i] = pm
+		index[pm] = i
+	}
+
+	err := p.producer.SendMessages(pms)
+	var perrs sarama.ProducerErrors
+	if err == nil || !errors.As(err, &perrs) || len(perrs) == 0 {
+		return err
+	}
+	failed := make([]oceanlog.KafkaMessage, 0, len(perrs))
+	for _, pe := range perrs {
+		if i, ok := index[pe.Msg]; ok {
+			failed = append(failed, msgs[i])
+		}
+	}
+	return &oceanlog.KafkaDeliveryError{Failed: failed, Err: perrs[0].Err}
+}
+
+// Close closes the sarama producer.
+func (p *Producer) Close() error {
+	return p.producer.Close()
+}
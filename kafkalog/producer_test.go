@@ -0,0 +1,94 @@
+package kafkalog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/v-mars/oceanlog"
+)
+
+func TestProducer(t *testing.T) {
+	sp := mocks.NewSyncProducer(t, nil)
+	sp.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(m *sarama.ProducerMessage) error {
+		assert.Equal(t, "logs", m.Topic)
+		assert.Equal(t, sarama.ByteEncoder("t1"), m.Key)
+		return nil
+	})
+	sp.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(m *sarama.ProducerMessage) error {
+		assert.Nil(t, m.Key)
+		return nil
+	})
+
+	var spill bytes.Buffer
+	w, err := oceanlog.NewKafkaWriter(oceanlog.KafkaConf{Topic: "logs", KeyFields: []string{"trace_id"},
+		Producer: NewProducerFrom(sp), BatchWait: time.Hour, Spill: &spill})
+	assert.NoError(t, err)
+	l := oceanlog.New(oceanlog.WithOutput(w))
+	l.CtxLogw(oceanlog.LevelInfo, context.Background(), nil, "keyed", "trace_id", "t1")
+	l.Info("unkeyed")
+	assert.NoError(t, w.Flush())
+
+	// the failed batch is spilled
+	sp.ExpectSendMessageAndFail(sarama.ErrNotLeaderForPartition)
+	l.Info("lost")
+	assert.ErrorIs(t, w.Flush(), sarama.ErrNotLeaderForPartition)
+	assert.Contains(t, spill.String(), `"message":"lost"`)
+	assert.NoError(t, w.Close())
+}
+
+// partialProducer fails the messages whose value is "fail".
+type partialProducer struct {
+	sarama.SyncProducer
+}
+
+func (p partialProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	var errs sarama.ProducerErrors
+	for _, m := range msgs {
+		if v, _ := m.Value.Encode(); string(v) == "fail" {
+			errs = append(errs, &sarama.ProducerError{Msg: m, Err: sarama.ErrMessageSizeTooLarge})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func TestProducer_partial(t *testing.T) {
+	p := NewProducerFrom(partialProducer{})
+	msgs := []oceanlog.KafkaMessage{{Topic: "logs", Value: []byte("ok")}, {Topic: "logs", Value: []byte("fail")}}
+	err := p.Produce(context.Background(), msgs)
+
+	var de *oceanlog.KafkaDeliveryError
+	if assert.ErrorAs(t, err, &de) {
+		assert.Equal(t, msgs[1:], de.Failed)
+		assert.ErrorIs(t, err, sarama.ErrMessageSizeTooLarge)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.True(t, errors.Is(p.Produce(ctx, msgs), context.Canceled))
+}
+
+func TestConfig(t *testing.T) {
+	config, err := Config(oceanlog.KafkaConf{ClientID: "api"})
+	assert.NoError(t, err)
+	assert.Equal(t, sarama.CompressionSnappy, config.Producer.Compression)
+	assert.Equal(t, sarama.WaitForAll, config.Producer.RequiredAcks)
+	assert.Equal(t, "api", config.ClientID)
+
+	config, err = Config(oceanlog.KafkaConf{Compression: oceanlog.KafkaCompressionZstd, Acks: oceanlog.KafkaAcksLeader})
+	assert.NoError(t, err)
+	assert.Equal(t, sarama.CompressionZSTD, config.Producer.Compression)
+	assert.Equal(t, sarama.WaitForLocal, config.Producer.RequiredAcks)
+
+	_, err = Config(oceanlog.KafkaConf{Compression: "brotli"})
+	assert.EqualError(t, err, `kafka: unknown compression "brotli"`)
+	_, err = Config(oceanlog.KafkaConf{Acks: "some"})
+	assert.EqualError(t, err, `kafka: unknown acks "some"`)
+}
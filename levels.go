@@ -17,10 +17,16 @@
 package oceanlog
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/cloudwego/hertz/pkg/common/hlog"
 	"github.com/rs/zerolog"
 )
 
+// noticeLevel is the zerolog level of notice records, see DefaultLogger.newEvent.
+const noticeLevel = zerolog.NoLevel
+
 var (
 	zerologLevels = map[hlog.Level]zerolog.Level{
 		hlog.LevelTrace:  zerolog.TraceLevel,
@@ -39,9 +45,28 @@ var (
 		zerolog.WarnLevel:  hlog.LevelWarn,
 		zerolog.ErrorLevel: hlog.LevelError,
 		zerolog.FatalLevel: hlog.LevelFatal,
+		noticeLevel:        hlog.LevelNotice,
+	}
+
+	levelNames = map[string]hlog.Level{
+		"trace":          hlog.LevelTrace,
+		"debug":          hlog.LevelDebug,
+		"info":           hlog.LevelInfo,
+		LevelNoticeValue: hlog.LevelNotice,
+		"warn":           hlog.LevelWarn,
+		"error":          hlog.LevelError,
+		"fatal":          hlog.LevelFatal,
 	}
 )
 
+// parseLevel returns the level named s, case-insensitive, e.g. "notice" or "WARN".
+func parseLevel(s string) (hlog.Level, error) {
+	if level, found := levelNames[strings.ToLower(s)]; found {
+		return level, nil
+	}
+	return hlog.LevelInfo, fmt.Errorf("unknown level %q", s)
+}
+
 // matchHlogLevel map hlog.Level to zerolog.Level
 func matchHlogLevel(level hlog.Level) zerolog.Level {
 	zlvl, found := zerologLevels[level]
@@ -5,12 +5,17 @@ import (
 	"fmt"
 	"github.com/cloudwego/hertz/pkg/common/hlog"
 	hertzlogrus "github.com/hertz-contrib/logger/logrus"
+	"github.com/rs/zerolog"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/natefinch/lumberjack.v2"
 	"io"
 	"log"
+	"math"
 	"os"
 	"path"
+	"path/filepath"
+	"sync"
+	"time"
 )
 
 const (
@@ -38,9 +43,9 @@ func InitOceanLog(LogFileName, logFormat string, level hlog.Level) *DefaultLogge
 		WithOutput(iw),   // allows to specify output
 		WithLevel(level), // option with log level
 		WithFormattedTimestamp("2006-01-02 15:04:05"), // option with timestamp
+		WithCaller(), // 自动记录日志调用位置
 		//WithTimestamp(),                               // option with timestamp
 		//WithFields(map[string]interface{}{})
-		//WithCallerSkipFrameCount(6), // 自动记录日志调用位置
 		//WithCaller(),                                  // 自动记录日志调用位置
 		// ...
 	)
@@ -67,16 +72,249 @@ func getLumberjackLogger(fileName string) *lumberjack.Logger {
 	return lumberjackLogger
 }
 
-func (c *LogConf) GetHzLog(ctx context.Context) *hertzlogrus.Logger {
-	lumberjackLogger := GetLumberjackLogger(c)
+// writer returns the outputs and sinks enabled in c, passed through the redactor if configured.
+func (c *LogConf) writer() io.Writer {
+	iw := withSinks(c.outputs())
+	if r := c.redactor(); r != nil {
+		iw = r.Wrap(iw)
+	}
+	return iw
+}
+
+// redactor returns the redactor of c.Redact, or nil. An invalid configuration is reported and
+// replaced by a redactor masking every value, see maskAll.
+func (c *LogConf) redactor() *Redactor {
+	if c.Redact == nil {
+		return nil
+	}
+	r, err := NewRedactor(*c.Redact)
+	if err != nil {
+		// fail closed: no secret gets through a configuration that does not compile
+		log.Printf("redact: %v, masking every value", err)
+		return maskAll(*c.Redact)
+	}
+	return r
+}
+
+// output returns the outputs enabled in c. The records the log file cannot take go to stderr.
+func (c *LogConf) output() io.Writer {
 	var writers []io.Writer
 	if c.Fileout {
-		writers = append(writers, lumberjackLogger)
+		writers = append(writers, NewFallbackWriter(c.sink("file", GetLumberjackLogger(c)), c.sink("stderr", os.Stderr)))
 	}
 	if c.Stdout {
-		writers = append(writers, os.Stdout)
+		writers = append(writers, c.sink("stdout", os.Stdout))
+	}
+	// a failing output does not stop the others
+	return zerolog.MultiLevelWriter(writers...) // os.Stdout, logger.Gin.Writer()
+}
+
+// sink returns w behind a circuit breaker reporting its health to c.
+func (c *LogConf) sink(name string, w io.Writer) *SinkWriter {
+	var conf BreakerConf
+	if c.Breaker != nil {
+		conf = *c.Breaker
+	}
+	s := NewSinkWriter(name, w, conf)
+	s.SetErrorHandler(c.OnWriteError)
+	if c.Metrics != nil {
+		s.SetMetrics(c.Metrics)
+	}
+	r := c.registry()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sinks = append(r.sinks, s)
+	return s
+}
+
+// registries guards the creation of the registry of a LogConf that was not built by NewDefaultLogger.
+var registries sync.Mutex
+
+// registry returns the registry of c, creating it if c was not built by NewDefaultLogger.
+func (c *LogConf) registry() *sinkRegistry {
+	registries.Lock()
+	defer registries.Unlock()
+	if c.health == nil {
+		c.health = &sinkRegistry{}
+	}
+	return c.health
+}
+
+type sinkRegistry struct {
+	mu    sync.Mutex
+	sinks []*SinkWriter
+
+	once   sync.Once
+	output io.Writer
+	remote []io.Writer
+}
+
+// outputs returns the outputs and the remote sinks enabled in c. They are built by the first logger
+// created from c and shared by the next ones, so that each sink and its spool directory exist once;
+// later changes of c do not apply to them.
+func (c *LogConf) outputs() (io.Writer, []io.Writer) {
+	r := c.registry()
+	r.once.Do(func() {
+		r.output, r.remote = c.output(), c.sinks()
+	})
+	return r.output, r.remote
+}
+
+// Health returns the health of the outputs and sinks of the loggers created from c, one entry per
+// output or sink however many loggers share it.
+//
+// The copies of a LogConf built by NewDefaultLogger share its outputs and health. A LogConf built
+// otherwise, e.g. decoded from a configuration file, gets them with its first logger or Health call:
+// use it through a pointer, a copy made before does not see them.
+func (c *LogConf) Health() []SinkHealth {
+	r := c.registry()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	health := make([]SinkHealth, len(r.sinks))
+	for i, s := range r.sinks {
+		health[i] = s.Health()
+	}
+	return health
+}
+
+// sinks returns the remote sinks enabled in c. A sink that cannot be created is reported and skipped.
+// With c.Spool, the network sinks are behind a spool each.
+func (c *LogConf) sinks() []io.Writer {
+	var sinks []io.Writer
+	add := func(name string, w io.Writer, err error) {
+		if err != nil {
+			log.Println(err.Error())
+			return
+		}
+		sinks = append(sinks, c.sink(name, c.spooled(name, w)))
 	}
-	iw := io.MultiWriter(writers...) // os.Stdout, logger.Gin.Writer()
+	if c.Syslog != nil {
+		w, err := NewSyslogWriter(*c.Syslog)
+		add("syslog", w, err)
+	}
+	if c.Journald != nil {
+		sinks = append(sinks, c.sink("journald", NewJournaldWriter(*c.Journald)))
+	}
+	if c.Loki != nil {
+		conf := *c.Loki
+		if c.Spool != nil {
+			conf.BatchSize, conf.BatchWait = math.MaxInt32, spoolBatchWait
+		}
+		w, err := NewLokiWriter(conf)
+		add("loki", w, err)
+	}
+	if c.Fluent != nil {
+		conf := *c.Fluent
+		if c.Spool != nil {
+			conf.BatchSize, conf.FlushInterval = math.MaxInt32, spoolBatchWait
+		}
+		w, err := NewFluentWriter(conf)
+		add("fluent", w, err)
+	}
+	if c.GELF != nil {
+		w, err := NewGELFWriter(*c.GELF)
+		add("gelf", w, err)
+	}
+	if c.Elasticsearch != nil {
+		conf := *c.Elasticsearch
+		if c.Spool != nil {
+			conf.BatchSize, conf.BatchWait = math.MaxInt32, spoolBatchWait
+		}
+		w, err := NewElasticsearchWriter(conf)
+		add("elasticsearch", w, err)
+	}
+	if c.Kafka != nil {
+		conf := *c.Kafka
+		if conf.Spill == nil && c.Fileout {
+			// undelivered records are kept next to the log file, which has them already
+			conf.Spill = c.kafkaSpill()
+		}
+		if c.Spool != nil {
+			conf.BatchSize, conf.BatchWait = math.MaxInt32, spoolBatchWait
+		}
+		w, err := NewKafkaWriter(conf)
+		add("kafka", w, err)
+	}
+	return sinks
+}
+
+// spoolBatchWait disables the background sends of the batching sinks behind a spool: they send when
+// the spool flushes them, so that it knows whether the records were delivered.
+const spoolBatchWait = 24 * time.Hour
+
+// spooled returns w behind a spool in the directory name of c.Spool, or w without c.Spool.
+// The spools are in the spool directory next to the log file by default.
+func (c *LogConf) spooled(name string, w io.Writer) io.Writer {
+	if c.Spool == nil {
+		return w
+	}
+	conf := *c.Spool
+	if conf.Dir == "" {
+		conf.Dir = filepath.Join(filepath.Dir(c.LogFileName), "spool")
+	}
+	conf.Dir = filepath.Join(conf.Dir, name)
+	s, err := NewSpoolWriter(w, conf)
+	if err != nil {
+		log.Println(err.Error())
+		return w
+	}
+	return s
+}
+
+// withSinks returns out followed by sinks. A failing sink does not stop the others.
+func withSinks(out io.Writer, sinks []io.Writer) io.Writer {
+	if len(sinks) == 0 {
+		return out
+	}
+	return zerolog.MultiLevelWriter(append([]io.Writer{out}, sinks...)...)
+}
+
+// level returns the level of c.Level, LevelInfo if it is empty or unknown. An unknown level is reported.
+func (c *LogConf) level() Level {
+	if c.Level == "" {
+		return LevelInfo
+	}
+	level, err := parseLevel(c.Level)
+	if err != nil {
+		log.Printf("%v, using info", err)
+	}
+	return level
+}
+
+// GetOceanLog returns a DefaultLogger writing to the outputs enabled in c.
+func (c *LogConf) GetOceanLog() *DefaultLogger {
+	iw, sinks := c.outputs()
+	if c.Formatter != logJson {
+		iw = NewConsole(iw)
+	}
+	// the sinks get the JSON records
+	iw = withSinks(iw, sinks)
+	opts := []Opt{
+		WithOutput(iw),
+		WithLevel(c.level()),
+		WithFormattedTimestamp("2006-01-02 15:04:05"),
+		WithCaller(),
+	}
+	if r := c.redactor(); r != nil {
+		opts = append(opts, WithRedactor(r))
+	}
+	if c.Sampling != nil {
+		opts = append(opts, WithSampler(NewSampler(*c.Sampling)))
+	}
+	if c.Metrics != nil {
+		opts = append(opts, WithMetrics(c.Metrics))
+	}
+	// Flush pushes the records batched by the sinks
+	for _, sink := range sinks {
+		if f, ok := sink.(interface{ Flush() error }); ok {
+			opts = append(opts, WithFlush(f.Flush))
+		}
+	}
+	return New(opts...)
+}
+
+func (c *LogConf) GetHzLog(ctx context.Context) *hertzlogrus.Logger {
+	iw := c.writer()
 	lo := hertzlogrus.NewLogger(hertzlogrus.WithLogger(logrus.New()))
 	temp := lo.Logger()
 	// 设置日志格式为json格式
@@ -101,15 +339,7 @@ func (c *LogConf) GetHzLog(ctx context.Context) *hertzlogrus.Logger {
 }
 
 func (c *LogConf) GetLogrusLog() *logrus.Logger {
-	lumberjackLogger := GetLumberjackLogger(c)
-	var writers []io.Writer
-	if c.Fileout {
-		writers = append(writers, lumberjackLogger)
-	}
-	if c.Stdout {
-		writers = append(writers, os.Stdout)
-	}
-	iw := io.MultiWriter(writers...) // os.Stdout, logger.Gin.Writer()
+	iw := c.writer()
 	// 设置日志格式为json格式
 	temp := logrus.Logger{}
 	if c.Formatter == "json" {
@@ -139,6 +369,20 @@ func defaultLumberjackLogger() *lumberjack.Logger {
 	}
 }
 
+// kafkaSpill returns the file of the undelivered Kafka records, <LogFileName>.kafka-undelivered,
+// rotated like the log file.
+func (c *LogConf) kafkaSpill() *lumberjack.Logger {
+	l := GetLumberjackLogger(c)
+	return &lumberjack.Logger{
+		Filename:   c.LogFileName + ".kafka-undelivered",
+		MaxSize:    l.MaxSize,
+		MaxAge:     l.MaxAge,
+		MaxBackups: l.MaxBackups,
+		LocalTime:  l.LocalTime,
+		Compress:   l.Compress,
+	}
+}
+
 func GetLumberjackLogger(c *LogConf) *lumberjack.Logger {
 	if err := InitOutToFile(c.LogFileName); err != nil {
 		panic(err)
@@ -189,6 +433,7 @@ func NewDefaultLogger(LogFileName, level string, opts ...Option) *LogConf {
 		Stdout:      true,
 		Fileout:     true,
 		Lumberjack:  defaultLumberjackLogger(),
+		health:      &sinkRegistry{},
 	}
 	cfg.Lumberjack.Filename = LogFileName
 	// apply options
@@ -205,6 +450,25 @@ type LogConf struct {
 	Fileout     bool   // 日志文件输出
 	Level       string
 	Lumberjack  *lumberjack.Logger
+	Redact      *RedactConf   `json:"redact"`   // 敏感信息脱敏
+	Sampling    *SamplingConf `json:"sampling"` // 日志采样和限流
+	Syslog      *SyslogConf   `json:"syslog"`   // 输出到 syslog
+	Journald    *JournaldConf `json:"journald"` // 输出到 systemd-journald
+	Loki        *LokiConf     `json:"loki"`     // 推送到 Grafana Loki
+	Fluent      *FluentConf   `json:"fluent"`   // 通过 Forward 协议发送到 Fluentd/Fluent Bit
+	GELF        *GELFConf     `json:"gelf"`     // 发送到 Graylog
+	// 批量写入 Elasticsearch/OpenSearch
+	Elasticsearch *ElasticsearchConf `json:"elasticsearch"`
+	Kafka         *KafkaConf         `json:"kafka"`   // 发布到 Kafka topic
+	Spool         *SpoolConf         `json:"spool"`   // 远程 sink 的磁盘缓冲
+	Breaker       *BreakerConf       `json:"breaker"` // 每个输出的熔断配置
+	// 输出写入失败时的回调
+	OnWriteError WriteErrorHandler `json:"-"`
+	// 日志指标，如 NewPrometheusMetrics()
+	Metrics Metrics `json:"-"`
+
+	// health is shared by the copies of c made once it is set, see Health
+	health *sinkRegistry
 }
 
 // Option logger options
@@ -224,3 +488,73 @@ func WithLumberjackLogger(logger *lumberjack.Logger) Option {
 		cfg.Lumberjack = logger
 	})
 }
+
+// WithRedact masks sensitive fields and values before they reach any output
+func WithRedact(conf RedactConf) Option {
+	return option(func(cfg *LogConf) {
+		cfg.Redact = &conf
+	})
+}
+
+// WithSyslog writes the records to syslog as well
+func WithSyslog(conf SyslogConf) Option {
+	return option(func(cfg *LogConf) {
+		cfg.Syslog = &conf
+	})
+}
+
+// WithJournald writes the records to systemd-journald as well
+func WithJournald(conf JournaldConf) Option {
+	return option(func(cfg *LogConf) {
+		cfg.Journald = &conf
+	})
+}
+
+// WithLoki pushes the records to Grafana Loki as well
+func WithLoki(conf LokiConf) Option {
+	return option(func(cfg *LogConf) {
+		cfg.Loki = &conf
+	})
+}
+
+// WithFluent sends the records to Fluentd or Fluent Bit as well
+func WithFluent(conf FluentConf) Option {
+	return option(func(cfg *LogConf) {
+		cfg.Fluent = &conf
+	})
+}
+
+// WithGELF sends the records to Graylog as well
+func WithGELF(conf GELFConf) Option {
+	return option(func(cfg *LogConf) {
+		cfg.GELF = &conf
+	})
+}
+
+// WithElasticsearch indexes the records in Elasticsearch as well
+func WithElasticsearch(conf ElasticsearchConf) Option {
+	return option(func(cfg *LogConf) {
+		cfg.Elasticsearch = &conf
+	})
+}
+
+// WithKafka publishes the records to Kafka as well
+func WithKafka(conf KafkaConf) Option {
+	return option(func(cfg *LogConf) {
+		cfg.Kafka = &conf
+	})
+}
+
+// WithSpool puts the network sinks behind an on-disk spool
+func WithSpool(conf SpoolConf) Option {
+	return option(func(cfg *LogConf) {
+		cfg.Spool = &conf
+	})
+}
+
+// WithSampling samples and rate limits the records of GetOceanLog
+func WithSampling(conf SamplingConf) Option {
+	return option(func(cfg *LogConf) {
+		cfg.Sampling = &conf
+	})
+}
@@ -1,9 +1,14 @@
 package oceanlog
 
 import (
+	"bytes"
 	"context"
 	"io"
+	"log"
+	"path/filepath"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 // MockLumberjackLogger 模拟 lumberjack logger
@@ -15,3 +20,24 @@ func TestNew(t *testing.T) {
 	a := InitOceanLog("test.log", "console", LevelDebug)
 	a.CtxDebugf(context.Background(), "test")
 }
+
+func TestLogConf_level(t *testing.T) {
+	var reported bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&reported)
+
+	for name, want := range map[string]Level{
+		"":        LevelInfo,
+		"notice":  LevelNotice,
+		"NOTICE":  LevelNotice,
+		"trace":   LevelTrace,
+		"warn":    LevelWarn,
+		"verbose": LevelInfo,
+	} {
+		c := NewDefaultLogger(filepath.Join(t.TempDir(), "app.log"), name)
+		c.Stdout, c.Fileout = false, false
+		assert.Equal(t, want, c.GetOceanLog().GetLevel(), name)
+	}
+	assert.Contains(t, reported.String(), `unknown level "verbose", using info`)
+	assert.Equal(t, 1, bytes.Count(reported.Bytes(), []byte("\n")))
+}
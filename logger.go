@@ -8,23 +8,46 @@ import (
 	"github.com/rs/zerolog"
 	"io"
 	"os"
-	"path/filepath"
-	"sync"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"unsafe"
 )
 
 var _ hlog.FullLogger = (*DefaultLogger)(nil)
 
 const (
+	// LevelNoticeValue is the level field value of notice records.
+	LevelNoticeValue = "notice"
+	// LoggerFieldName is the field name of the logger name, see WithName and DefaultLogger.Named.
+	LoggerFieldName = "logger"
+
 	LogIDKey = "request_id"
+	// ReqIDKey is the plain string context key of the request ID.
+	//
+	// Deprecated: use ContextWithRequestID, a string key collides with other packages.
 	ReqIDKey = "X-Request-ID"
 )
 
 // DefaultLogger is a wrapper around `zerolog.Logger` that provides an implementation of `FullLogger` interface
 type DefaultLogger struct {
-	log     zerolog.Logger
-	out     io.Writer
-	level   zerolog.Level
-	options []Opt
+	// log is at trace level, the level of the records is checked against level
+	log zerolog.Logger
+	// output is the writer of log, the writer of the zerolog logger of From if WithOutput is not given
+	output *swapWriter
+	level  *atomic.Int32
+	// replaced is the logger set by SetLogger, l logs through it
+	replaced *atomic.Pointer[DefaultLogger]
+	redactor *Redactor
+	metrics  Metrics
+	exitFunc func(code int)
+	flush    []func() error
+	err      error
+	// errorStack captures the stack of errors logged without one
+	errorStack bool
+	name       string
+	clock      Clock
+	options    []Opt
 }
 
 // ConsoleWriter parses the JSON input and writes it in an
@@ -39,7 +62,7 @@ func NewConsole(Out io.Writer) ConsoleWriter {
 	cw.FormatLevel = func(lv interface{}) string {
 		return fmt.Sprintf("[%s]", lv)
 	}
-	// 自定义 Caller 显示格式，只显示文件名和行数
+	// 自定义 Caller 显示格式，只显示文件名
 	cw.FormatCaller = func(caller interface{}) string {
 		if caller == nil || caller == "" {
 			return ""
@@ -51,8 +74,14 @@ func NewConsole(Out io.Writer) ConsoleWriter {
 			return ""
 		}
 
-		// 转换为 "logger_test.go:76"
-		return fmt.Sprintf("%s:", filepath.Base(callerStr))
+		// 去掉行号并兼容 Windows 路径，转换为 "logger_test.go:"
+		if i := strings.LastIndexByte(callerStr, ':'); i > 0 {
+			callerStr = callerStr[:i]
+		}
+		if i := strings.LastIndexAny(callerStr, `/\`); i >= 0 {
+			callerStr = callerStr[i+1:]
+		}
+		return fmt.Sprintf("%s:", callerStr)
 	}
 	return cw
 }
@@ -62,34 +91,22 @@ func MultiLevelWriter(writers ...io.Writer) zerolog.LevelWriter {
 	return zerolog.MultiLevelWriter(writers...)
 }
 
-// 在 init 函数中设置全局的 Caller 格式化函数
-func init() {
-	zerolog.CallerMarshalFunc = func(pc uintptr, file string, line int) string {
-		// 只返回文件名和行数，例如 "logger_test.go:76"
-		return fmt.Sprintf("%s:%d", filepath.Base(file), line)
-	}
-}
-
-// New returns a new DefaultLogger instance
+// New returns a new DefaultLogger instance. It logs the caller unless WithoutCaller is given.
 func New(options ...Opt) *DefaultLogger {
-	var l = zerolog.New(os.Stdout).With().CallerWithSkipFrameCount(4).Logger()
+	var l = zerolog.New(os.Stdout)
 	traceHookConfig := &TraceHookConfig{
 		recordStackTraceInSpan: true,
 		enableLevels:           AllLevel,
 		errorSpanLevel:         zerolog.ErrorLevel,
 	}
-	// add request_id hook
-	options = append(options, WithHookFunc(func(e *zerolog.Event, level zerolog.Level, message string) {
-		if e.GetCtx() == nil {
-			return
-		}
-		logId, ok := e.GetCtx().Value(ReqIDKey).(string)
-		if ok {
-			e.Str(LogIDKey, logId)
-		}
-	}))
 	options = append(options, WithHook(NewTraceHook(traceHookConfig)))
-	return newLogger(l, options)
+	defaults := []Opt{
+		WithOutput(os.Stdout),
+		WithCaller(),
+		WithContextExtractor(RequestIDExtractor()),
+		WithContextExtractor(ContextFieldsExtractor()),
+	}
+	return newLogger(l, append(defaults, options...))
 }
 
 // From returns a new DefaultLogger instance using an existing logger
@@ -111,85 +128,206 @@ func GetLogger() (DefaultLogger, error) {
 	return DefaultLogger{}, errors.New("GetDefaultLogger is not a zerolog logger")
 }
 
-// SetOutput setting output for logger
+// SetOutput setting output for logger. It is safe to call while other goroutines are logging,
+// unless the logger was created by From without WithOutput and its output is set for the first time.
 func (l *DefaultLogger) SetOutput(writer io.Writer) {
-	l.out = writer
-	l.log = l.log.Output(writer)
+	l = l.current()
+	l.output.store(writer, l.redactor, l.metrics)
+}
+
+// out returns the output set with WithOutput or SetOutput, or nil.
+func (l *DefaultLogger) out() io.Writer {
+	return l.output.load().out
+}
+
+// writer returns the output records are written to, including the redactor.
+func (l *DefaultLogger) writer() io.Writer {
+	return l.output.load().w
 }
 
 // WithContext returns context with logger attached
 func (l *DefaultLogger) WithContext(ctx context.Context) context.Context {
-	return l.log.WithContext(ctx)
+	l = l.current()
+	return l.Unwrap().WithContext(ctx)
 }
 
-// WithField appends a field to the logger
+// WithField returns a copy of the logger with the field appended, l is unchanged.
+// Like WithError, the copy starts with the level and output of l.
 func (l *DefaultLogger) WithField(key string, value interface{}) DefaultLogger {
-	l.log = l.log.With().Interface(key, value).Logger()
-	return *l
+	c := l.current().derive()
+	c.log = c.log.With().Interface(key, value).Logger()
+	return *c
+}
+
+// Named returns a logger named name below l, e.g. "app.db" for the name "db" of the logger "app".
+// The returned logger starts with the level and output of l, SetLevel and SetOutput on one of them
+// do not change the other.
+func (l *DefaultLogger) Named(name string) *DefaultLogger {
+	l = l.current()
+	c := l.derive()
+	if l.name != "" {
+		c.name = l.name + "." + name
+	} else {
+		c.name = name
+	}
+	return c
+}
+
+// derive returns a copy of l with its own level and output, set to the current ones of l.
+func (l *DefaultLogger) derive() *DefaultLogger {
+	c := *l
+	c.level = &atomic.Int32{}
+	c.level.Store(l.level.Load())
+	c.output = &swapWriter{}
+	c.output.v.Store(l.output.v.Load())
+	c.log = c.log.Output(c.output)
+	c.replaced = &atomic.Pointer[DefaultLogger]{}
+	return &c
+}
+
+// current returns the logger set by SetLogger, or l.
+func (l *DefaultLogger) current() *DefaultLogger {
+	for l.replaced != nil {
+		r := l.replaced.Load()
+		if r == nil {
+			break
+		}
+		l = r
+	}
+	return l
 }
 
-// Unwrap returns the underlying zerolog logger
+// Name returns the name of l, see WithName.
+func (l *DefaultLogger) Name() string {
+	return l.current().name
+}
+
+// Unwrap returns the underlying zerolog logger, at the current level of l
 func (l *DefaultLogger) Unwrap() zerolog.Logger {
-	return l.log
+	l = l.current()
+	return l.log.Level(matchHlogLevel(l.GetLevel()))
+}
+
+// GetLevel returns the current level of l.
+func (l *DefaultLogger) GetLevel() Level {
+	return Level(l.current().level.Load())
 }
 
 // Log log using zerolog logger with specified level
 func (l *DefaultLogger) Log(level Level, kvs ...interface{}) {
-	switch level {
-	case LevelTrace, LevelDebug:
-		l.log.Debug().Msg(fmt.Sprint(kvs...))
-	case LevelInfo:
-		l.log.Info().Msg(fmt.Sprint(kvs...))
-	case LevelNotice, LevelWarn:
-		l.log.Warn().Msg(fmt.Sprint(kvs...))
-	case LevelError:
-		l.log.Error().Msg(fmt.Sprint(kvs...))
-	case LevelFatal:
-		l.log.Fatal().Msg(fmt.Sprint(kvs...))
-	default:
-		l.log.Warn().Msg(fmt.Sprint(kvs...))
+	l = l.current()
+	zl := l.Unwrap()
+	l.newEvent(&zl, level, nil, nil).Msg(fmt.Sprint(kvs...))
+	if level == LevelFatal {
+		l.exit()
 	}
 }
 
 // Logf log using zerolog logger with specified level and formatting
 func (l *DefaultLogger) Logf(level Level, format string, kvs ...interface{}) {
-	switch level {
-	case LevelTrace, LevelDebug:
-		l.log.Debug().Msg(fmt.Sprintf(format, kvs...))
-	case LevelInfo:
-		l.log.Info().Msg(fmt.Sprintf(format, kvs...))
-	case LevelNotice, LevelWarn:
-		l.log.Warn().Msg(fmt.Sprintf(format, kvs...))
-	case LevelError:
-		l.log.Error().Msg(fmt.Sprintf(format, kvs...))
-	case LevelFatal:
-		l.log.Fatal().Msg(fmt.Sprintf(format, kvs...))
-	default:
-		l.log.Warn().Msg(fmt.Sprintf(format, kvs...))
+	l = l.current()
+	zl := l.Unwrap()
+	l.newEvent(&zl, level, nil, nil).Msg(fmt.Sprintf(format, kvs...))
+	if level == LevelFatal {
+		l.exit()
 	}
 }
 
 // CtxLogf log with logger associated with context.
 // If no logger is associated, DefaultContextLogger is used, unless DefaultContextLogger is nil, in which case a disabled logger is used.
 func (l *DefaultLogger) CtxLogf(level Level, ctx context.Context, format string, kvs ...interface{}) {
-	//logId, _ := ctx.Value(ReqIDKey).(string)
+	l = l.current()
+	unwrap := l.ctxLogger(level, ctx)
+	l.newEvent(&unwrap, level, ctx, nil).Msg(fmt.Sprintf(format, kvs...))
+	if level == LevelFatal {
+		l.exit()
+	}
+}
 
+// ctxLogger returns the zerolog logger for a record of ctx at level, buffering it in the debug buffer of ctx
+// when level is below the logger level.
+func (l *DefaultLogger) ctxLogger(level Level, ctx context.Context) zerolog.Logger {
 	unwrap := l.Unwrap()
-	// todo add hook
+	if b := DebugBufferFromContext(ctx); b != nil && l.out() != nil {
+		switch {
+		case level <= LevelDebug && matchHlogLevel(level) < unwrap.GetLevel():
+			// keep the record until the request fails
+			unwrap = unwrap.Output(b.writer(l, ctx)).Level(zerolog.TraceLevel)
+		case level >= LevelError:
+			b.Flush()
+		}
+	}
+	return unwrap
+}
+
+// newEvent starts a record of zl at level with the context ctx and the error err, or the error of WithError.
+// Fatal records do not exit, the caller runs exit once the record is written.
+func (l *DefaultLogger) newEvent(zl *zerolog.Logger, level Level, ctx context.Context, err error) *zerolog.Event {
+	e := l.levelEvent(zl, level)
+	if err == nil {
+		err = l.err
+	}
+	if e != nil && err != nil {
+		e = errorFields(e, err, l.errorStack)
+		ctx = contextWithError(ctx, err)
+	}
+	if l.name != "" {
+		e = e.Str(LoggerFieldName, l.name)
+		if l.metrics != nil && e != nil {
+			ctx = contextWithLoggerName(ctx, l.name)
+		}
+	}
+	return e.Ctx(ctx)
+}
+
+// levelEvent starts a record of zl at level.
+// zerolog has no notice level: notice records are written without zerolog level and carry
+// LevelNoticeValue as level field, so they are filtered here instead of by zerolog.
+func (l *DefaultLogger) levelEvent(zl *zerolog.Logger, level Level) *zerolog.Event {
 	switch level {
-	case LevelTrace, LevelDebug:
-		unwrap.Debug().Ctx(ctx).Msg(fmt.Sprintf(format, kvs...))
+	case LevelTrace:
+		return zl.Trace()
+	case LevelDebug:
+		return zl.Debug()
 	case LevelInfo:
-		unwrap.Info().Ctx(ctx).Msg(fmt.Sprintf(format, kvs...))
-	case LevelNotice, LevelWarn:
-		unwrap.Warn().Ctx(ctx).Msg(fmt.Sprintf(format, kvs...))
+		return zl.Info()
+	case LevelNotice:
+		if l.GetLevel() > LevelNotice {
+			return nil
+		}
+		return zl.WithLevel(noticeLevel).Str(zerolog.LevelFieldName, LevelNoticeValue)
+	case LevelWarn:
+		return zl.Warn()
 	case LevelError:
-		unwrap.Error().Ctx(ctx).Msg(fmt.Sprintf(format, kvs...))
+		return zl.Error()
 	case LevelFatal:
-		unwrap.Fatal().Ctx(ctx).Msg(fmt.Sprintf(format, kvs...))
+		return zl.WithLevel(zerolog.FatalLevel)
 	default:
-		unwrap.Warn().Ctx(ctx).Msg(fmt.Sprintf(format, kvs...))
+		return zl.Warn()
+	}
+}
+
+// exit flushes the outputs and calls the exit function after a fatal record.
+func (l *DefaultLogger) exit() {
+	_ = l.Flush()
+	l.exitFunc(1)
+}
+
+// Flush flushes the output if it has a Sync() error or Flush() error method,
+// then runs the functions added with WithFlush.
+func (l *DefaultLogger) Flush() error {
+	l = l.current()
+	var errs []error
+	switch w := l.out().(type) {
+	case interface{ Sync() error }:
+		errs = append(errs, w.Sync())
+	case interface{ Flush() error }:
+		errs = append(errs, w.Flush())
+	}
+	for _, fn := range l.flush {
+		errs = append(errs, fn())
 	}
+	return errors.Join(errs...)
 }
 
 // Trace logs a message at trace level.
@@ -222,7 +360,7 @@ func (l *DefaultLogger) Error(v ...interface{}) {
 	l.Log(LevelError, v...)
 }
 
-// Fatal logs a message at fatal level.
+// Fatal logs a message at fatal level, flushes the outputs and calls the exit function.
 func (l *DefaultLogger) Fatal(v ...interface{}) {
 	l.Log(LevelFatal, v...)
 }
@@ -244,7 +382,7 @@ func (l *DefaultLogger) Infof(format string, v ...interface{}) {
 
 // Noticef logs a formatted message at notice level.
 func (l *DefaultLogger) Noticef(format string, v ...interface{}) {
-	l.Logf(LevelWarn, format, v...)
+	l.Logf(LevelNotice, format, v...)
 }
 
 // Warnf logs a formatted message at warn level.
@@ -257,9 +395,9 @@ func (l *DefaultLogger) Errorf(format string, v ...interface{}) {
 	l.Logf(LevelError, format, v...)
 }
 
-// Fatalf logs a formatted message at fatal level.
+// Fatalf logs a formatted message at fatal level, flushes the outputs and calls the exit function.
 func (l *DefaultLogger) Fatalf(format string, v ...interface{}) {
-	l.Logf(LevelError, format, v...)
+	l.Logf(LevelFatal, format, v...)
 }
 
 // CtxTracef logs a message at trace level with logger associated with context.
@@ -298,49 +436,131 @@ func (l *DefaultLogger) CtxErrorf(ctx context.Context, format string, v ...inter
 	l.CtxLogf(LevelError, ctx, format, v...)
 }
 
-// CtxFatalf logs a message at fatal level with logger associated with context.
+// CtxFatalf logs a message at fatal level with logger associated with context,
+// flushes the outputs and calls the exit function.
 // If no logger is associated, DefaultContextLogger is used, unless DefaultContextLogger is nil, in which case a disabled logger is used.
 func (l *DefaultLogger) CtxFatalf(ctx context.Context, format string, v ...interface{}) {
 	l.CtxLogf(LevelFatal, ctx, format, v...)
 }
 
 func newLogger(log zerolog.Logger, options []Opt) *DefaultLogger {
-	opts := newOptions(log, options)
-
-	return &DefaultLogger{
-		log:     opts.context.Logger(),
-		out:     nil,
-		level:   opts.level,
-		options: options,
+	ts := &timestampHook{}
+	opts := newOptions(log.Hook(ts), options)
+
+	l := &DefaultLogger{
+		log:        opts.context.Logger().Level(zerolog.TraceLevel),
+		output:     &swapWriter{},
+		level:      &atomic.Int32{},
+		replaced:   &atomic.Pointer[DefaultLogger]{},
+		redactor:   opts.redactor,
+		metrics:    opts.metrics,
+		exitFunc:   opts.exit,
+		flush:      opts.flush,
+		errorStack: opts.errorStack,
+		name:       opts.name,
+		clock:      opts.clock,
+		options:    options,
+	}
+	if l.clock == nil {
+		l.clock = SystemClock
+	}
+	// before the first record, the hook is not called concurrently yet
+	ts.clock, ts.conf = l.clock, opts.timestamp
+	if opts.caller != nil {
+		l.log = l.log.Hook(callerHook{conf: *opts.caller})
+	}
+	l.level.Store(int32(opts.hlevel))
+	out := opts.out
+	if out == nil {
+		out = zerologWriter(log)
+	}
+	l.output.store(out, l.redactor, l.metrics)
+	l.log = l.log.Output(l.output)
+	if len(opts.extractors) > 0 {
+		l.log = l.log.Hook(extractorHook(opts.extractors))
 	}
+	if opts.sampler != nil {
+		l.log = l.log.Hook(opts.sampler)
+		opts.sampler.attach(l, opts.clock)
+	}
+	if opts.metrics != nil {
+		// after the sampler, to tell the sampled records
+		l.log = l.log.Hook(metricsHook{m: opts.metrics})
+	}
+	if len(opts.finalHooks) > 0 {
+		l.log = l.log.Hook(opts.finalHooks...)
+	}
+	return l
 }
 
-var loggerMutex sync.Mutex
-
+// SetLogger makes l log through v, a *DefaultLogger, so that every holder of l logs like v, including
+// after SetLevel or SetOutput on either of them. It is safe to call while other goroutines are logging through l.
 func (l *DefaultLogger) SetLogger(v interface{}) {
-	// 检查输入是否为nil
-	if v == nil {
+	tmp, ok := v.(*DefaultLogger)
+	if !ok || tmp == nil || tmp == l {
 		return
 	}
+	// a logger already logging through l makes l log with its own configuration again
+	if tmp = tmp.current(); tmp == l {
+		tmp = nil
+	}
+	l.replaced.Store(tmp)
+}
 
-	// 类型断言检查
-	tmp, ok := v.(*DefaultLogger)
-	if ok {
-		// 添加并发保护
-		loggerMutex.Lock()
-		defer loggerMutex.Unlock()
+// SetLevel setting logging level for logger. It is safe to call while other goroutines are logging.
+func (l *DefaultLogger) SetLevel(level hlog.Level) {
+	l.current().level.Store(int32(level))
+}
 
-		l = tmp
-		return
+var _ zerolog.LevelWriter = (*swapWriter)(nil)
+
+// zerologWriter returns the writer of log, which zerolog does not export.
+func zerologWriter(log zerolog.Logger) io.Writer {
+	f := reflect.ValueOf(&log).Elem().FieldByName("w")
+	if !f.IsValid() {
+		return io.Discard
+	}
+	w, _ := reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem().Interface().(io.Writer)
+	if w == nil {
+		// the zero zerolog.Logger is disabled
+		return io.Discard
 	}
+	return w
+}
 
-	// 可选：添加类型不匹配的日志记录
-	// log.Printf("SetLogger: expected *DefaultLogger, got %T", v)
+// swapWriter is the output of a logger, replaced atomically by SetOutput.
+type swapWriter struct {
+	v atomic.Pointer[outputs]
 }
 
-// SetLevel setting logging level for logger
-func (l *DefaultLogger) SetLevel(level hlog.Level) {
-	lvl := matchHlogLevel(level)
-	l.level = lvl
-	l.log = l.log.Level(lvl)
+type outputs struct {
+	// out is the output set by the user
+	out io.Writer
+	// w is out with the redactor, if any
+	w io.Writer
+}
+
+func (s *swapWriter) store(out io.Writer, r *Redactor, m Metrics) {
+	w := out
+	if r != nil && out != nil {
+		w = &redactWriter{r: r, w: out, metrics: m}
+	}
+	s.v.Store(&outputs{out: out, w: w})
+}
+
+func (s *swapWriter) load() *outputs {
+	if o := s.v.Load(); o != nil {
+		return o
+	}
+	return &outputs{}
+}
+
+// Write implements io.Writer.
+func (s *swapWriter) Write(p []byte) (int, error) {
+	return s.load().w.Write(p)
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (s *swapWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	return writeLevel(s.load().w, level, p)
 }
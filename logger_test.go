@@ -20,8 +20,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/cloudwego/hertz/pkg/common/hlog"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
@@ -44,6 +49,9 @@ func TestFrom(t *testing.T) {
 }
 
 func TestGetLogger_notSet(t *testing.T) {
+	prev := logger.Swap(nil)
+	defer logger.Store(prev)
+
 	_, err := GetLogger()
 
 	assert.Error(t, err)
@@ -71,9 +79,13 @@ func TestLoggerWithField(t *testing.T) {
 	b := &bytes.Buffer{}
 	l := New()
 	l.SetOutput(b)
-	l.WithField("service", "logging")
+	fl := l.WithField("service", "logging")
 
+	fl.Info("foobar")
+	// l is unchanged
 	l.Info("foobar")
+	assert.NotContains(t, strings.Split(b.String(), "\n")[1], "service")
+	b.Truncate(strings.IndexByte(b.String(), '\n') + 1)
 
 	type Log struct {
 		Level   string `json:"level"`
@@ -101,13 +113,13 @@ func TestUnwrap(t *testing.T) {
 
 func TestLog(t *testing.T) {
 	b := &bytes.Buffer{}
-	l := New()
+	l := New(WithoutCaller())
 	l.SetOutput(b)
 
 	l.Trace("foo")
 	assert.Equal(
 		t,
-		`{"level":"debug","message":"foo"}
+		`{"level":"trace","message":"foo"}
 `,
 		b.String(),
 	)
@@ -134,7 +146,7 @@ func TestLog(t *testing.T) {
 	l.Notice("foo")
 	assert.Equal(
 		t,
-		`{"level":"warn","message":"foo"}
+		`{"level":"notice","message":"foo"}
 `,
 		b.String(),
 	)
@@ -160,13 +172,13 @@ func TestLog(t *testing.T) {
 
 func TestLogf(t *testing.T) {
 	b := &bytes.Buffer{}
-	l := New()
+	l := New(WithoutCaller())
 	l.SetOutput(b)
 
 	l.Tracef("foo%s", "bar")
 	assert.Equal(
 		t,
-		`{"level":"debug","message":"foobar"}
+		`{"level":"trace","message":"foobar"}
 `,
 		b.String(),
 	)
@@ -193,7 +205,7 @@ func TestLogf(t *testing.T) {
 	l.Noticef("foo%s", "bar")
 	assert.Equal(
 		t,
-		`{"level":"warn","message":"foobar"}
+		`{"level":"notice","message":"foobar"}
 `,
 		b.String(),
 	)
@@ -219,14 +231,14 @@ func TestLogf(t *testing.T) {
 
 func TestCtxTracef(t *testing.T) {
 	b := &bytes.Buffer{}
-	l := New()
+	l := New(WithoutCaller())
 	l.SetOutput(b)
 	ctx := l.log.WithContext(context.Background())
 
 	l.CtxTracef(ctx, "foo%s", "bar")
 	assert.Equal(
 		t,
-		`{"level":"debug","message":"foobar"}
+		`{"level":"trace","message":"foobar"}
 `,
 		b.String(),
 	)
@@ -235,7 +247,7 @@ func TestCtxTracef(t *testing.T) {
 
 func TestCtxDebugf(t *testing.T) {
 	b := &bytes.Buffer{}
-	l := New()
+	l := New(WithoutCaller())
 	l.SetOutput(b)
 	ctx := l.log.WithContext(context.Background())
 
@@ -251,7 +263,7 @@ func TestCtxDebugf(t *testing.T) {
 
 func TestCtxInfof(t *testing.T) {
 	b := &bytes.Buffer{}
-	l := New()
+	l := New(WithoutCaller())
 	l.SetOutput(b)
 	ctx := l.log.WithContext(context.Background())
 
@@ -267,14 +279,14 @@ func TestCtxInfof(t *testing.T) {
 
 func TestCtxNoticef(t *testing.T) {
 	b := &bytes.Buffer{}
-	l := New()
+	l := New(WithoutCaller())
 	l.SetOutput(b)
 	ctx := l.log.WithContext(context.Background())
 
 	l.CtxNoticef(ctx, "foo%s", "bar")
 	assert.Equal(
 		t,
-		`{"level":"warn","message":"foobar"}
+		`{"level":"notice","message":"foobar"}
 `,
 		b.String(),
 	)
@@ -283,7 +295,7 @@ func TestCtxNoticef(t *testing.T) {
 
 func TestCtxWarnf(t *testing.T) {
 	b := &bytes.Buffer{}
-	l := New()
+	l := New(WithoutCaller())
 	l.SetOutput(b)
 	ctx := l.log.WithContext(context.Background())
 
@@ -299,7 +311,7 @@ func TestCtxWarnf(t *testing.T) {
 
 func TestCtxErrorf(t *testing.T) {
 	b := &bytes.Buffer{}
-	l := New()
+	l := New(WithoutCaller())
 	l.SetOutput(b)
 	ctx := l.log.WithContext(context.Background())
 
@@ -317,13 +329,13 @@ func TestSetLevel(t *testing.T) {
 	l := New()
 
 	l.SetLevel(LevelDebug)
-	assert.Equal(t, l.log.GetLevel(), zerolog.DebugLevel)
+	assert.Equal(t, zerolog.DebugLevel, l.Unwrap().GetLevel())
 
 	l.SetLevel(LevelDebug)
-	assert.Equal(t, l.log.GetLevel(), zerolog.DebugLevel)
+	assert.Equal(t, zerolog.DebugLevel, l.Unwrap().GetLevel())
 
 	l.SetLevel(LevelError)
-	assert.Equal(t, l.log.GetLevel(), zerolog.ErrorLevel)
+	assert.Equal(t, zerolog.ErrorLevel, l.Unwrap().GetLevel())
 }
 
 // TestNewConsole_Integration 测试整个 ConsoleWriter 的集成行为
@@ -373,3 +385,227 @@ func TestNewConsole_FormatCaller_Normal(t *testing.T) {
 		}
 	}
 }
+
+func TestNotice_level(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := New(WithOutput(b), WithLevel(LevelNotice), WithoutCaller())
+
+	l.Info("foo")
+	l.Notice("foo")
+	assert.Equal(t, "{\"level\":\"notice\",\"message\":\"foo\"}\n", b.String())
+
+	b.Reset()
+	l.SetLevel(LevelWarn)
+	l.Notice("foo")
+	l.CtxNoticef(context.Background(), "foo")
+	assert.Empty(t, b.String())
+}
+
+func TestFatal(t *testing.T) {
+	b := &bytes.Buffer{}
+	var codes []int
+	flushed := 0
+	l := New(WithOutput(b),
+		WithExitFunc(func(code int) { codes = append(codes, code) }),
+		WithFlush(func() error { flushed++; return nil }), WithoutCaller())
+
+	l.Fatal("foo")
+	l.Fatalf("foo%s", "bar")
+	l.CtxFatalf(context.Background(), "foo%s", "bar")
+
+	assert.Equal(t, []int{1, 1, 1}, codes)
+	assert.Equal(t, 3, flushed)
+	assert.Equal(t, `{"level":"fatal","message":"foo"}
+{"level":"fatal","message":"foobar"}
+{"level":"fatal","message":"foobar"}
+`, b.String())
+}
+
+func TestReplaceGlobal(t *testing.T) {
+	prev := GetDefaultLogger()
+	prevHlog := hlog.DefaultLogger()
+	b := &bytes.Buffer{}
+	l := New(WithOutput(b), WithoutCaller())
+
+	restore := ReplaceGlobal(l, WithHlog())
+	assert.Same(t, l, GetDefaultLogger())
+	Info("foo")
+	hlog.Info("bar")
+	assert.Equal(t, "{\"level\":\"info\",\"message\":\"foo\"}\n{\"level\":\"info\",\"message\":\"bar\"}\n", b.String())
+
+	restore()
+	assert.Same(t, prev, GetDefaultLogger())
+	assert.Equal(t, prevHlog, hlog.DefaultLogger())
+}
+
+func TestReplaceGlobal_nil(t *testing.T) {
+	prev := GetDefaultLogger()
+	prevHlog := hlog.DefaultLogger()
+
+	restore := ReplaceGlobal(nil, WithHlog())
+	assert.Same(t, prev, GetDefaultLogger())
+	assert.Equal(t, prevHlog, hlog.DefaultLogger())
+	assert.NotPanics(t, func() { Debug("foo") })
+	restore()
+	assert.Same(t, prev, GetDefaultLogger())
+}
+
+func TestReplaceGlobal_concurrent(t *testing.T) {
+	defer ReplaceGlobal(New(WithOutput(io.Discard)))()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				Infof("foo %d", j)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				SetLogger(New(WithOutput(io.Discard)))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestDefaultLogger_SetLogger(t *testing.T) {
+	b1, b2 := &bytes.Buffer{}, &bytes.Buffer{}
+	l := New(WithOutput(b1), WithoutCaller())
+	l.SetLogger(New(WithOutput(b2), WithLevel(LevelWarn), WithoutCaller()))
+
+	l.Info("dropped")
+	l.Warn("foo")
+
+	assert.Empty(t, b1.String())
+	assert.Equal(t, "{\"level\":\"warn\",\"message\":\"foo\"}\n", b2.String())
+}
+
+func TestSetLevelSetOutput_concurrent(t *testing.T) {
+	b1, b2 := &syncBuffer{}, &syncBuffer{}
+	l := New(WithOutput(b1), WithRedactor(MustNewRedactor(RedactConf{Keys: []string{"password"}})))
+	child := l.WithError(errors.New("boom"))
+	// a From logger without WithOutput writes to the writer of the zerolog logger until SetOutput
+	f := From(zerolog.New(b1))
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				l.Infof("password=%s", "secret")
+				l.CtxDebugf(context.Background(), "debug")
+				l.Notice("notice")
+				child.Error("failed")
+				f.Info("from")
+				fl := f.WithField("user", "bob")
+				fl.Info("from")
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		l.SetLevel(Level(i % 7))
+		if i%2 == 0 {
+			l.SetOutput(b2)
+			f.SetOutput(b2)
+		} else {
+			l.SetOutput(b1)
+			f.SetOutput(b1)
+		}
+		_ = l.Unwrap()
+		_ = f.WithField("step", i)
+	}
+	close(stop)
+	wg.Wait()
+
+	// the copy keeps its own level and output
+	l.SetLevel(LevelFatal)
+	child.Error("kept")
+	l.Error("dropped")
+	lines := b1.Lines()
+	assert.Contains(t, lines[len(lines)-1], `"message":"kept"`)
+	for _, line := range b2.Lines() {
+		assert.NotContains(t, line, "failed")
+	}
+	for _, line := range append(lines, b2.Lines()...) {
+		assert.NotContains(t, line, "secret")
+		assert.NotContains(t, line, "dropped")
+		// WithField does not change f
+		if strings.Contains(line, `"message":"from"`) {
+			assert.NotContains(t, line, "step")
+		}
+	}
+}
+
+func TestNamed_ownLevelAndOutput(t *testing.T) {
+	parent, child := &bytes.Buffer{}, &bytes.Buffer{}
+	l := New(WithOutput(parent), WithLevel(LevelInfo))
+	db := l.Named("db")
+	db.SetLevel(LevelDebug)
+	db.SetOutput(child)
+	l.SetLevel(LevelWarn)
+
+	l.Debug("parent debug")
+	l.Warn("parent warn")
+	db.Debug("child debug")
+	assert.Equal(t, LevelWarn, l.GetLevel())
+	assert.Equal(t, LevelDebug, db.GetLevel())
+	assert.NotContains(t, parent.String(), "debug")
+	assert.Contains(t, parent.String(), "parent warn")
+	assert.Contains(t, child.String(), "child debug")
+	assert.Equal(t, LevelWarn, l.Named("api").WithError(errors.New("boom")).GetLevel())
+}
+
+func TestSetLogger_concurrent(t *testing.T) {
+	b1, b2 := &syncBuffer{}, &syncBuffer{}
+	l := New(WithOutput(b1))
+	other := New(WithOutput(b2), WithLevel(LevelWarn))
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				l.Warn("logged")
+				l.CtxErrorw(context.Background(), nil, "failed")
+				_ = l.GetLevel()
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		l.SetLogger(other)
+		l.SetLogger(New(WithOutput(b1)))
+	}
+	close(stop)
+	wg.Wait()
+
+	l.SetLogger(other)
+	other.SetLevel(LevelError)
+	l.Warn("dropped")
+	l.Error("replaced")
+	lines := b2.Lines()
+	assert.Contains(t, lines[len(lines)-1], `"message":"replaced"`)
+	assert.NotContains(t, strings.Join(lines, "\n"), "dropped")
+	assert.Equal(t, LevelError, l.GetLevel())
+
+	// a logger logging through l cannot make l log through itself
+	other.SetLogger(l)
+	assert.Equal(t, other, other.current())
+}
@@ -0,0 +1,428 @@
+package oceanlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var _ zerolog.LevelWriter = (*LokiWriter)(nil)
+
+// Loki push encodings.
+const (
+	// LokiProtobuf is the snappy compressed logproto.PushRequest.
+	LokiProtobuf = "protobuf"
+	LokiJSON     = "json"
+)
+
+// LokiConf configures a LokiWriter.
+type LokiConf struct {
+	URL         string            `json:"url"`          // push API, e.g. http://loki:3100/loki/api/v1/push
+	TenantID    string            `json:"tenant_id"`    // X-Scope-OrgID
+	Labels      map[string]string `json:"labels"`       // static labels, e.g. {"service": "order"}
+	LabelFields []string          `json:"label_fields"` // low-cardinality fields used as labels, ["level"] by default
+	Encoding    string            `json:"encoding"`     // LokiProtobuf, the default, or LokiJSON
+	BatchSize   int               `json:"batch_size"`   // bytes of log lines per push, 1 MiB by default
+	MaxBuffer   int               `json:"max_buffer"`   // bytes of log lines kept while Loki is unavailable, 64 MiB by default
+	BatchWait   time.Duration     `json:"batch_wait"`   // maximum delay of a record, 1s by default
+	MinBackoff  time.Duration     `json:"min_backoff"`  // first retry delay, 500ms by default
+	MaxBackoff  time.Duration     `json:"max_backoff"`  // 5s by default
+	MaxRetries  int               `json:"max_retries"`  // 10 by default
+	Timeout     time.Duration     `json:"timeout"`      // per push, 10s by default
+}
+
+// LokiWriter pushes JSON records to Grafana Loki in batches, one stream per label set.
+// Pushes failing with a network error, 429 or 5xx are retried with exponential backoff;
+// a push that still fails is reported with the standard logger and dropped, the next pushes of the
+// batch are still sent. The buffer is bounded
+// by MaxBuffer, the oldest records are dropped beyond.
+type LokiWriter struct {
+	conf   LokiConf
+	client *http.Client
+
+	mu      sync.Mutex
+	now     func() time.Time
+	pending []lokiEntry
+	size    int
+	dropped int
+	closed  bool
+
+	// send serializes the pushes
+	send sync.Mutex
+	full chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type lokiStream struct {
+	labels  map[string]string
+	entries []lokiEntry
+}
+
+type lokiEntry struct {
+	// key is the labels in the LogQL selector form
+	key    string
+	labels map[string]string
+	time   time.Time
+	line   string
+}
+
+// NewLokiWriter returns a writer pushing to the Loki server of conf.
+func NewLokiWriter(conf LokiConf) (*LokiWriter, error) {
+	if conf.URL == "" {
+		return nil, fmt.Errorf("loki: no url")
+	}
+	if conf.Encoding == "" {
+		conf.Encoding = LokiProtobuf
+	}
+	if conf.Encoding != LokiProtobuf && conf.Encoding != LokiJSON {
+		return nil, fmt.Errorf("loki: unknown encoding %q", conf.Encoding)
+	}
+	if conf.LabelFields == nil {
+		conf.LabelFields = []string{zerolog.LevelFieldName}
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 1 << 20
+	}
+	if conf.MaxBuffer <= 0 {
+		conf.MaxBuffer = 64 << 20
+	}
+	if conf.BatchWait <= 0 {
+		conf.BatchWait = time.Second
+	}
+	if conf.MinBackoff <= 0 {
+		conf.MinBackoff = 500 * time.Millisecond
+	}
+	if conf.MaxBackoff <= 0 {
+		conf.MaxBackoff = 5 * time.Second
+	}
+	if conf.MaxRetries <= 0 {
+		conf.MaxRetries = 10
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 10 * time.Second
+	}
+
+	w := &LokiWriter{
+		conf:   conf,
+		client: &http.Client{Timeout: conf.Timeout},
+		now:    time.Now,
+		full:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// SetClock sets the clock of the entry timestamps. By default, it is SystemClock.
+func (w *LokiWriter) SetClock(c Clock) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.now = c.Now
+}
+
+// Write implements io.Writer.
+func (w *LokiWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (w *LokiWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	line := string(bytes.TrimRight(p, "\r\n"))
+	r := parseRecord(p, level)
+	labels := w.labels(r)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, fmt.Errorf("loki: writer closed")
+	}
+	w.pending = append(w.pending, lokiEntry{key: lokiLabels(labels), labels: labels, time: r.timeOr(w.now), line: line})
+	w.size += len(line)
+	for w.size > w.conf.MaxBuffer && len(w.pending) > 1 {
+		w.size -= len(w.pending[0].line)
+		w.pending[0] = lokiEntry{}
+		w.pending = w.pending[1:]
+		w.dropped++
+	}
+	if w.size >= w.conf.BatchSize {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Flush pushes the pending records, in pushes of at most BatchSize bytes of log lines.
+// The records of a push that fails are dropped, the error tells how many.
+func (w *LokiWriter) Flush() error {
+	w.send.Lock()
+	defer w.send.Unlock()
+
+	entries, dropped := w.take()
+	if dropped > 0 {
+		log.Printf("loki: dropped %d records, buffer limit %d bytes reached", dropped, w.conf.MaxBuffer)
+	}
+	// a failed push only drops its own records, the next ones are still pushed
+	var failed int
+	var errs []error
+	for len(entries) > 0 {
+		chunk := lokiChunk(entries, w.conf.BatchSize)
+		if err := w.push(lokiStreams(chunk)); err != nil {
+			failed += len(chunk)
+			errs = append(errs, err)
+		}
+		entries = entries[len(chunk):]
+	}
+	if failed > 0 {
+		return fmt.Errorf("loki: dropped %d records: %w", failed, errors.Join(errs...))
+	}
+	return nil
+}
+
+// Close stops the writer and pushes the pending records, without retrying.
+func (w *LokiWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.done)
+	w.wg.Wait()
+	return w.Flush()
+}
+
+func (w *LokiWriter) run() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.conf.BatchWait)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.full:
+		case <-w.done:
+			return
+		}
+		if err := w.Flush(); err != nil {
+			log.Println(err.Error())
+		}
+	}
+}
+
+// take returns the pending records and the number of records dropped since the last call.
+func (w *LokiWriter) take() ([]lokiEntry, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	entries, dropped := w.pending, w.dropped
+	w.pending, w.size, w.dropped = nil, 0, 0
+	return entries, dropped
+}
+
+// lokiChunk returns the first entries whose lines add up to at most size bytes, at least one entry.
+func lokiChunk(entries []lokiEntry, size int) []lokiEntry {
+	n, total := 1, len(entries[0].line)
+	for n < len(entries) && total+len(entries[n].line) <= size {
+		total += len(entries[n].line)
+		n++
+	}
+	return entries[:n]
+}
+
+// lokiStreams groups entries by labels, the streams ordered by labels.
+func lokiStreams(entries []lokiEntry) []*lokiStream {
+	byKey := map[string]*lokiStream{}
+	keys := []string{}
+	for _, e := range entries {
+		s, ok := byKey[e.key]
+		if !ok {
+			s = &lokiStream{labels: e.labels}
+			byKey[e.key] = s
+			keys = append(keys, e.key)
+		}
+		s.entries = append(s.entries, e)
+	}
+	sort.Strings(keys)
+	streams := make([]*lokiStream, 0, len(keys))
+	for _, k := range keys {
+		streams = append(streams, byKey[k])
+	}
+	return streams
+}
+
+// push sends streams, retrying with backoff.
+func (w *LokiWriter) push(streams []*lokiStream) error {
+	body, contentType, err := w.encode(streams)
+	if err != nil {
+		return err
+	}
+	backoff := w.conf.MinBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(body, contentType)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= w.conf.MaxRetries || !w.wait(backoff) {
+			return err
+		}
+		if backoff *= 2; backoff > w.conf.MaxBackoff {
+			backoff = w.conf.MaxBackoff
+		}
+	}
+}
+
+// wait sleeps for d, it returns false if the writer is closed meanwhile.
+func (w *LokiWriter) wait(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// post sends one push request. retry reports whether a failure is temporary.
+func (w *LokiWriter) post(body []byte, contentType string) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, w.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if w.conf.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", w.conf.TenantID)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	err = fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5, err
+}
+
+// labels returns the static labels and the label fields of r.
+func (w *LokiWriter) labels(r record) map[string]string {
+	labels := make(map[string]string, len(w.conf.Labels)+len(w.conf.LabelFields))
+	for k, v := range w.conf.Labels {
+		labels[lokiLabelName(k)] = v
+	}
+	for _, name := range w.conf.LabelFields {
+		if name == zerolog.LevelFieldName {
+			if r.level != "" {
+				labels[lokiLabelName(name)] = r.level
+			}
+			continue
+		}
+		for _, f := range r.fields {
+			if f.key == name {
+				labels[lokiLabelName(name)] = f.String()
+				break
+			}
+		}
+	}
+	return labels
+}
+
+func (w *LokiWriter) encode(streams []*lokiStream) ([]byte, string, error) {
+	if w.conf.Encoding == LokiJSON {
+		type jsonStream struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		}
+		req := struct {
+			Streams []jsonStream `json:"streams"`
+		}{}
+		for _, s := range streams {
+			js := jsonStream{Stream: s.labels}
+			for _, e := range s.entries {
+				js.Values = append(js.Values, [2]string{strconv.FormatInt(e.time.UnixNano(), 10), e.line})
+			}
+			req.Streams = append(req.Streams, js)
+		}
+		body, err := json.Marshal(req)
+		return body, "application/json", err
+	}
+
+	// logproto.PushRequest{streams: [{labels, entries: [{timestamp, line}]}]}
+	var req []byte
+	for _, s := range streams {
+		var stream []byte
+		stream = protowire.AppendTag(stream, 1, protowire.BytesType)
+		stream = protowire.AppendString(stream, lokiLabels(s.labels))
+		for _, e := range s.entries {
+			var ts []byte
+			ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(e.time.Unix()))
+			ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(e.time.Nanosecond()))
+
+			var entry []byte
+			entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+			entry = protowire.AppendBytes(entry, ts)
+			entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+			entry = protowire.AppendString(entry, e.line)
+
+			stream = protowire.AppendTag(stream, 2, protowire.BytesType)
+			stream = protowire.AppendBytes(stream, entry)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, stream)
+	}
+	return snappy.Encode(nil, req), "application/x-protobuf", nil
+}
+
+// lokiLabels returns labels in the LogQL selector form, {a="1", b="2"}.
+func lokiLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// lokiLabelName returns name as a label name: letters, digits and underscores, not starting with a digit.
+func lokiLabelName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
@@ -0,0 +1,269 @@
+package oceanlog
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type lokiPushed struct {
+	labels string
+	time   time.Time
+	line   string
+}
+
+// fakeLoki decodes the push requests it receives, failing the first failures of them with status.
+type fakeLoki struct {
+	*httptest.Server
+	status   atomic.Int32
+	failures atomic.Int32
+	requests atomic.Int32
+
+	mu      sync.Mutex
+	entries []lokiPushed
+	tenant  string
+}
+
+func newFakeLoki(t *testing.T) *fakeLoki {
+	f := &fakeLoki{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f.requests.Add(1) <= f.failures.Load() {
+			w.WriteHeader(int(f.status.Load()))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.tenant = r.Header.Get("X-Scope-OrgID")
+		if r.Header.Get("Content-Type") == "application/json" {
+			f.decodeJSON(t, body)
+		} else {
+			f.decodeProtobuf(t, body)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeLoki) decodeJSON(t *testing.T, body []byte) {
+	var req struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &req))
+	for _, s := range req.Streams {
+		for _, v := range s.Values {
+			ns, _ := strconv.ParseInt(v[0], 10, 64)
+			f.entries = append(f.entries, lokiPushed{labels: lokiLabels(s.Stream), time: time.Unix(0, ns), line: v[1]})
+		}
+	}
+}
+
+func (f *fakeLoki) decodeProtobuf(t *testing.T, body []byte) {
+	req, err := snappy.Decode(nil, body)
+	assert.NoError(t, err)
+	for _, stream := range protoMessages(req, 1) {
+		labels := string(protoMessages(stream, 1)[0])
+		for _, entry := range protoMessages(stream, 2) {
+			ts := protoMessages(entry, 1)[0]
+			sec, n := protowire.ConsumeVarint(ts[1:])
+			nsec, _ := protowire.ConsumeVarint(ts[1+n+1:])
+			f.entries = append(f.entries, lokiPushed{labels: labels, time: time.Unix(int64(sec), int64(nsec)),
+				line: string(protoMessages(entry, 2)[0])})
+		}
+	}
+}
+
+// protoMessages returns the length-delimited values of field num in b.
+func protoMessages(b []byte, num protowire.Number) [][]byte {
+	var values [][]byte
+	for len(b) > 0 {
+		n, typ, l := protowire.ConsumeTag(b)
+		b = b[l:]
+		l = protowire.ConsumeFieldValue(n, typ, b)
+		if n == num && typ == protowire.BytesType {
+			v, _ := protowire.ConsumeBytes(b)
+			values = append(values, v)
+		}
+		b = b[l:]
+	}
+	return values
+}
+
+func (f *fakeLoki) pushed() []lokiPushed {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]lokiPushed(nil), f.entries...)
+}
+
+func TestLokiWriter_protobuf(t *testing.T) {
+	loki := newFakeLoki(t)
+	w, err := NewLokiWriter(LokiConf{URL: loki.URL, TenantID: "team-a", Labels: map[string]string{"service.name": "order"},
+		LabelFields: []string{"level", "region"}, BatchWait: time.Hour})
+	assert.NoError(t, err)
+	defer w.Close()
+	w.SetClock(syslogTime)
+	l := New(WithOutput(w), WithoutCaller())
+
+	l.Info("first")
+	zl := l.Unwrap().With().Str("region", "eu").Logger()
+	zl.Warn().Str("user", "alice").Msg("second")
+	assert.Empty(t, loki.pushed())
+	assert.NoError(t, w.Flush())
+
+	pushed := loki.pushed()
+	if assert.Len(t, pushed, 2) {
+		assert.Equal(t, `{level="info", service_name="order"}`, pushed[0].labels)
+		assert.Equal(t, `{"level":"info","message":"first"}`, pushed[0].line)
+		assert.True(t, time.Time(syslogTime).Equal(pushed[0].time))
+		assert.Equal(t, `{level="warn", region="eu", service_name="order"}`, pushed[1].labels)
+		assert.Contains(t, pushed[1].line, `"user":"alice"`)
+	}
+	assert.Equal(t, "team-a", loki.tenant)
+}
+
+func TestLokiWriter_json(t *testing.T) {
+	loki := newFakeLoki(t)
+	w, err := NewLokiWriter(LokiConf{URL: loki.URL, Encoding: LokiJSON, BatchWait: time.Hour})
+	assert.NoError(t, err)
+	defer w.Close()
+	w.SetClock(syslogTime)
+
+	New(WithOutput(w), WithoutCaller()).Error("failed")
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, []lokiPushed{{labels: `{level="error"}`, time: time.Unix(0, time.Time(syslogTime).UnixNano()),
+		line: `{"level":"error","message":"failed"}`}}, loki.pushed())
+}
+
+func TestLokiWriter_batch(t *testing.T) {
+	loki := newFakeLoki(t)
+	w, err := NewLokiWriter(LokiConf{URL: loki.URL, BatchSize: 100, BatchWait: time.Hour})
+	assert.NoError(t, err)
+	defer w.Close()
+	l := New(WithOutput(w))
+
+	l.Info("short")
+	assert.Never(t, func() bool { return len(loki.pushed()) > 0 }, 50*time.Millisecond, 5*time.Millisecond)
+	// the batch exceeds BatchSize
+	for i := 0; i < 5; i++ {
+		l.Info("a longer message")
+	}
+	assert.Eventually(t, func() bool { return len(loki.pushed()) == 6 }, time.Second, 5*time.Millisecond)
+
+	// BatchWait bounds the delay
+	w2, err := NewLokiWriter(LokiConf{URL: loki.URL, BatchWait: 20 * time.Millisecond})
+	assert.NoError(t, err)
+	defer w2.Close()
+	New(WithOutput(w2)).Info("waited")
+	assert.Eventually(t, func() bool { return len(loki.pushed()) == 7 }, time.Second, 5*time.Millisecond)
+}
+
+func TestLokiWriter_chunks(t *testing.T) {
+	loki := newFakeLoki(t)
+	w, err := NewLokiWriter(LokiConf{URL: loki.URL, BatchSize: 100, BatchWait: time.Hour})
+	assert.NoError(t, err)
+	defer w.Close()
+
+	// 46 bytes per line, two lines per push
+	for i := 0; i < 5; i++ {
+		_, _ = w.Write([]byte(`{"level":"info","message":"a longer message"}` + "\n"))
+	}
+	assert.NoError(t, w.Flush())
+	assert.Len(t, loki.pushed(), 5)
+	assert.Equal(t, int32(3), loki.requests.Load())
+}
+
+func TestLokiWriter_chunkFails(t *testing.T) {
+	loki := newFakeLoki(t)
+	loki.status.Store(http.StatusBadRequest)
+	loki.failures.Store(1)
+	w, err := NewLokiWriter(LokiConf{URL: loki.URL, BatchSize: 100, BatchWait: time.Hour})
+	assert.NoError(t, err)
+	defer w.Close()
+
+	// 46 bytes per line, two lines per push
+	for i := 0; i < 5; i++ {
+		_, _ = w.Write([]byte(`{"level":"info","message":"a longer message ` + strconv.Itoa(i) + `"}` + "\n"))
+	}
+	err = w.Flush()
+	// only the records of the failed push are dropped
+	assert.ErrorContains(t, err, "loki: dropped 2 records")
+	assert.Equal(t, int32(3), loki.requests.Load())
+	pushed := loki.pushed()
+	if assert.Len(t, pushed, 3) {
+		assert.Equal(t, `{"level":"info","message":"a longer message 2"}`, pushed[0].line)
+		assert.Equal(t, `{"level":"info","message":"a longer message 4"}`, pushed[2].line)
+	}
+}
+
+func TestLokiWriter_bounded(t *testing.T) {
+	loki := newFakeLoki(t)
+	w, err := NewLokiWriter(LokiConf{URL: loki.URL, MaxBuffer: 100, BatchWait: time.Hour})
+	assert.NoError(t, err)
+	defer w.Close()
+
+	for i := 0; i < 5; i++ {
+		_, _ = w.Write([]byte(`{"message":"record ` + strconv.Itoa(i) + `"}` + "\n"))
+	}
+	assert.NoError(t, w.Flush())
+	// the oldest records are dropped beyond MaxBuffer
+	pushed := loki.pushed()
+	if assert.Len(t, pushed, 4) {
+		assert.Equal(t, `{"message":"record 1"}`, pushed[0].line)
+		assert.Equal(t, `{"message":"record 4"}`, pushed[3].line)
+	}
+}
+
+func TestLokiWriter_retry(t *testing.T) {
+	loki := newFakeLoki(t)
+	loki.status.Store(http.StatusTooManyRequests)
+	loki.failures.Store(2)
+	w, err := NewLokiWriter(LokiConf{URL: loki.URL, BatchWait: time.Hour, MinBackoff: time.Millisecond})
+	assert.NoError(t, err)
+	defer w.Close()
+
+	New(WithOutput(w)).Info("retried")
+	assert.NoError(t, w.Flush())
+	assert.Len(t, loki.pushed(), 1)
+	assert.Equal(t, int32(3), loki.requests.Load())
+
+	// client errors are not retried
+	loki.status.Store(http.StatusBadRequest)
+	loki.failures.Store(4)
+	New(WithOutput(w)).Info("rejected")
+	assert.ErrorContains(t, w.Flush(), "400 Bad Request")
+	assert.Equal(t, int32(4), loki.requests.Load())
+}
+
+func TestLokiWriter_conf(t *testing.T) {
+	_, err := NewLokiWriter(LokiConf{})
+	assert.EqualError(t, err, "loki: no url")
+	_, err = NewLokiWriter(LokiConf{URL: "http://loki", Encoding: "xml"})
+	assert.EqualError(t, err, `loki: unknown encoding "xml"`)
+}
+
+func TestLogConf_loki(t *testing.T) {
+	loki := newFakeLoki(t)
+	c := NewDefaultLogger("", "info", WithLoki(LokiConf{URL: loki.URL, BatchWait: time.Hour}))
+	c.Stdout, c.Fileout = false, false
+	l := c.GetOceanLog()
+
+	l.Info("via conf")
+	assert.NoError(t, l.Flush())
+	if pushed := loki.pushed(); assert.Len(t, pushed, 1) {
+		assert.Contains(t, pushed[0].line, `"message":"via conf"`)
+	}
+}
@@ -0,0 +1,267 @@
+package oceanlog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	_ Metrics      = (*PrometheusMetrics)(nil)
+	_ http.Handler = (*PrometheusMetrics)(nil)
+)
+
+// Metrics receives the measurements of loggers and sinks. PrometheusMetrics implements it;
+// an adapter can forward them to a metrics library instead.
+type Metrics interface {
+	// Record counts a record written at level by the logger name, "" for unnamed loggers.
+	Record(level, logger string)
+	// Sampled counts a record dropped by the sampler.
+	Sampled()
+	// Redacted counts a record whose values were masked by the redactor.
+	Redacted()
+	// SinkWrite observes a write of n bytes to sink which took d and failed with err, if not nil.
+	SinkWrite(sink string, n int, d time.Duration, err error)
+	// Dropped counts a record sink refused without writing it, e.g. because its circuit was open.
+	Dropped(sink, reason string)
+}
+
+// DefaultLatencyBuckets are the bounds, in seconds, of the sink latency histograms.
+var DefaultLatencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+type loggerNameKey struct{}
+
+// contextWithLoggerName passes the logger name of a record to metricsHook.
+func contextWithLoggerName(ctx context.Context, name string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, loggerNameKey{}, name)
+}
+
+// metricsHook counts the records. It runs after the other hooks: a record discarded by the sampler
+// reaches it with the Disabled level.
+type metricsHook struct {
+	m Metrics
+}
+
+func (h metricsHook) Run(e *zerolog.Event, level zerolog.Level, _ string) {
+	if level == zerolog.Disabled {
+		h.m.Sampled()
+		return
+	}
+	name, _ := e.GetCtx().Value(loggerNameKey{}).(string)
+	h.m.Record(levelName(level), name)
+}
+
+func levelName(level zerolog.Level) string {
+	if level == noticeLevel {
+		return LevelNoticeValue
+	}
+	return level.String()
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative, the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+type sinkDrop struct {
+	sink   string
+	reason string
+}
+
+type loggerLevel struct {
+	level  string
+	logger string
+}
+
+// PrometheusMetrics keeps the measurements in memory and serves them in the Prometheus text
+// exposition format, without client library.
+type PrometheusMetrics struct {
+	buckets []float64
+
+	mu       sync.Mutex
+	records  map[loggerLevel]uint64
+	sampled  uint64
+	redacted uint64
+	bytes    map[string]uint64
+	errors   map[string]uint64
+	dropped  map[sinkDrop]uint64
+	latency  map[string]*histogram
+}
+
+// NewPrometheusMetrics returns empty metrics. The sink latency histograms use buckets, in seconds,
+// or DefaultLatencyBuckets if none.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &PrometheusMetrics{
+		buckets: buckets,
+		records: map[loggerLevel]uint64{},
+		bytes:   map[string]uint64{},
+		errors:  map[string]uint64{},
+		dropped: map[sinkDrop]uint64{},
+		latency: map[string]*histogram{},
+	}
+}
+
+// Record implements Metrics.
+func (p *PrometheusMetrics) Record(level, logger string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records[loggerLevel{level: level, logger: logger}]++
+}
+
+// Sampled implements Metrics.
+func (p *PrometheusMetrics) Sampled() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sampled++
+}
+
+// Redacted implements Metrics.
+func (p *PrometheusMetrics) Redacted() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.redacted++
+}
+
+// SinkWrite implements Metrics.
+func (p *PrometheusMetrics) SinkWrite(sink string, n int, d time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bytes[sink] += uint64(n)
+	if err != nil {
+		p.errors[sink]++
+	}
+	h := p.latency[sink]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(p.buckets)+1)}
+		p.latency[sink] = h
+	}
+	h.counts[sort.SearchFloat64s(p.buckets, d.Seconds())]++
+	h.sum += d.Seconds()
+	h.count++
+}
+
+// Dropped implements Metrics.
+func (p *PrometheusMetrics) Dropped(sink, reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dropped[sinkDrop{sink: sink, reason: reason}]++
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (p *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	b := bufio.NewWriter(w)
+	p.write(b)
+	_ = b.Flush()
+}
+
+func (p *PrometheusMetrics) write(b *bufio.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	promFamily(b, "oceanlog_records_total", "counter", "Records written per level and logger name.")
+	records := make([]loggerLevel, 0, len(p.records))
+	for k := range p.records {
+		records = append(records, k)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].logger != records[j].logger {
+			return records[i].logger < records[j].logger
+		}
+		return records[i].level < records[j].level
+	})
+	for _, k := range records {
+		promSample(b, "oceanlog_records_total", promLabels("level", k.level, "logger", k.logger), float64(p.records[k]))
+	}
+
+	promFamily(b, "oceanlog_sampled_records_total", "counter", "Records dropped by the sampler.")
+	promSample(b, "oceanlog_sampled_records_total", "", float64(p.sampled))
+	promFamily(b, "oceanlog_redacted_records_total", "counter", "Records whose values were masked by the redactor.")
+	promSample(b, "oceanlog_redacted_records_total", "", float64(p.redacted))
+
+	promFamily(b, "oceanlog_dropped_records_total", "counter", "Records refused by a sink without writing them.")
+	drops := make([]sinkDrop, 0, len(p.dropped))
+	for k := range p.dropped {
+		drops = append(drops, k)
+	}
+	sort.Slice(drops, func(i, j int) bool {
+		if drops[i].sink != drops[j].sink {
+			return drops[i].sink < drops[j].sink
+		}
+		return drops[i].reason < drops[j].reason
+	})
+	for _, k := range drops {
+		promSample(b, "oceanlog_dropped_records_total", promLabels("sink", k.sink, "reason", k.reason), float64(p.dropped[k]))
+	}
+
+	sinks := make([]string, 0, len(p.latency))
+	for sink := range p.latency {
+		sinks = append(sinks, sink)
+	}
+	sort.Strings(sinks)
+	promFamily(b, "oceanlog_sink_written_bytes_total", "counter", "Bytes written per sink.")
+	for _, sink := range sinks {
+		promSample(b, "oceanlog_sink_written_bytes_total", promLabels("sink", sink), float64(p.bytes[sink]))
+	}
+	promFamily(b, "oceanlog_sink_write_errors_total", "counter", "Failed writes per sink.")
+	for _, sink := range sinks {
+		promSample(b, "oceanlog_sink_write_errors_total", promLabels("sink", sink), float64(p.errors[sink]))
+	}
+	promFamily(b, "oceanlog_sink_write_duration_seconds", "histogram", "Latency of the writes per sink.")
+	for _, sink := range sinks {
+		h := p.latency[sink]
+		var cumulative uint64
+		for i, bound := range p.buckets {
+			cumulative += h.counts[i]
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			promSample(b, "oceanlog_sink_write_duration_seconds_bucket", promLabels("sink", sink, "le", le), float64(cumulative))
+		}
+		promSample(b, "oceanlog_sink_write_duration_seconds_bucket", promLabels("sink", sink, "le", "+Inf"), float64(h.count))
+		promSample(b, "oceanlog_sink_write_duration_seconds_sum", promLabels("sink", sink), h.sum)
+		promSample(b, "oceanlog_sink_write_duration_seconds_count", promLabels("sink", sink), float64(h.count))
+	}
+}
+
+func promFamily(b *bufio.Writer, name, typ, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func promSample(b *bufio.Writer, name, labels string, value float64) {
+	fmt.Fprintf(b, "%s%s %s\n", name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promLabels formats the name, value pairs kv as a label set.
+func promLabels(kv ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(kv[i])
+		b.WriteString(`="`)
+		b.WriteString(promLabelEscaper.Replace(kv[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
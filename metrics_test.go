@@ -0,0 +1,117 @@
+package oceanlog
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func scrape(t *testing.T, m *PrometheusMetrics) string {
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	return rec.Body.String()
+}
+
+func TestWithMetrics(t *testing.T) {
+	m := NewPrometheusMetrics()
+	l := New(WithOutput(io.Discard), WithLevel(LevelInfo), WithMetrics(m), WithName("api"),
+		WithRedactor(MustNewRedactor(RedactConf{Keys: []string{"password"}})),
+		WithSampler(NewSampler(SamplingConf{Burst: 2, Tick: time.Hour})))
+
+	l.Info("first")
+	l.Named("db").Info("second")
+	l.Info("sampled")
+	l.CtxErrorw(t.Context(), nil, "login", "password", "secret")
+	l.Notice("notice")
+	l.Debug("below the level")
+
+	out := scrape(t, m)
+	assert.Contains(t, out, "# TYPE oceanlog_records_total counter\n")
+	assert.Contains(t, out, `oceanlog_records_total{level="info",logger="api"} 1`+"\n")
+	assert.Contains(t, out, `oceanlog_records_total{level="info",logger="api.db"} 1`+"\n")
+	assert.Contains(t, out, `oceanlog_records_total{level="error",logger="api"} 1`+"\n")
+	assert.Contains(t, out, `oceanlog_records_total{level="notice",logger="api"} 1`+"\n")
+	assert.NotContains(t, out, `level="debug"`)
+	assert.Contains(t, out, "oceanlog_sampled_records_total 1\n")
+	assert.Contains(t, out, "oceanlog_redacted_records_total 1\n")
+}
+
+func TestPrometheusMetrics_sinks(t *testing.T) {
+	m := NewPrometheusMetrics(0.5, 0.01)
+	m.SinkWrite("file", 100, 5*time.Millisecond, nil)
+	m.SinkWrite("file", 50, time.Second, io.ErrShortWrite)
+	m.SinkWrite(`lo"ki`, 10, time.Millisecond, nil)
+	m.Dropped("loki", "circuit_open")
+
+	assert.Equal(t, `# HELP oceanlog_records_total Records written per level and logger name.
+# TYPE oceanlog_records_total counter
+# HELP oceanlog_sampled_records_total Records dropped by the sampler.
+# TYPE oceanlog_sampled_records_total counter
+oceanlog_sampled_records_total 0
+# HELP oceanlog_redacted_records_total Records whose values were masked by the redactor.
+# TYPE oceanlog_redacted_records_total counter
+oceanlog_redacted_records_total 0
+# HELP oceanlog_dropped_records_total Records refused by a sink without writing them.
+# TYPE oceanlog_dropped_records_total counter
+oceanlog_dropped_records_total{sink="loki",reason="circuit_open"} 1
+# HELP oceanlog_sink_written_bytes_total Bytes written per sink.
+# TYPE oceanlog_sink_written_bytes_total counter
+oceanlog_sink_written_bytes_total{sink="file"} 150
+oceanlog_sink_written_bytes_total{sink="lo\"ki"} 10
+# HELP oceanlog_sink_write_errors_total Failed writes per sink.
+# TYPE oceanlog_sink_write_errors_total counter
+oceanlog_sink_write_errors_total{sink="file"} 1
+oceanlog_sink_write_errors_total{sink="lo\"ki"} 0
+# HELP oceanlog_sink_write_duration_seconds Latency of the writes per sink.
+# TYPE oceanlog_sink_write_duration_seconds histogram
+oceanlog_sink_write_duration_seconds_bucket{sink="file",le="0.01"} 1
+oceanlog_sink_write_duration_seconds_bucket{sink="file",le="0.5"} 1
+oceanlog_sink_write_duration_seconds_bucket{sink="file",le="+Inf"} 2
+oceanlog_sink_write_duration_seconds_sum{sink="file"} 1.005
+oceanlog_sink_write_duration_seconds_count{sink="file"} 2
+oceanlog_sink_write_duration_seconds_bucket{sink="lo\"ki",le="0.01"} 1
+oceanlog_sink_write_duration_seconds_bucket{sink="lo\"ki",le="0.5"} 1
+oceanlog_sink_write_duration_seconds_bucket{sink="lo\"ki",le="+Inf"} 1
+oceanlog_sink_write_duration_seconds_sum{sink="lo\"ki"} 0.001
+oceanlog_sink_write_duration_seconds_count{sink="lo\"ki"} 1
+`, scrape(t, m))
+}
+
+func TestSinkWriter_metrics(t *testing.T) {
+	m := NewPrometheusMetrics()
+	sink := &flakySink{down: true}
+	s := NewSinkWriter("remote", sink, BreakerConf{Threshold: 1, Cooldown: time.Hour})
+	s.SetMetrics(m)
+
+	_, _ = s.Write([]byte("failed"))
+	_, _ = s.Write([]byte("dropped"))
+	out := scrape(t, m)
+	assert.Contains(t, out, `oceanlog_sink_write_errors_total{sink="remote"} 1`)
+	assert.Contains(t, out, `oceanlog_dropped_records_total{sink="remote",reason="circuit_open"} 1`)
+	assert.Contains(t, out, `oceanlog_sink_write_duration_seconds_count{sink="remote"} 1`)
+}
+
+func TestLogConf_metrics(t *testing.T) {
+	m := NewPrometheusMetrics()
+	c := NewDefaultLogger(filepath.Join(t.TempDir(), "app.log"), "info")
+	c.Stdout, c.Formatter, c.Metrics = false, logJson, m
+	l := c.GetOceanLog()
+
+	l.Info("counted")
+	out := scrape(t, m)
+	assert.Contains(t, out, `oceanlog_records_total{level="info",logger=""} 1`)
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, `oceanlog_sink_written_bytes_total{sink="file"}`) {
+			assert.NotEqual(t, `oceanlog_sink_written_bytes_total{sink="file"} 0`, line)
+			return
+		}
+	}
+	t.Error("no bytes written to the file")
+}
@@ -0,0 +1,362 @@
+// Package oceanlogtest provides an observer logger recording the entries logged in tests.
+package oceanlogtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/v-mars/oceanlog"
+)
+
+// seqFieldName is the field linking a written record to the context captured by the observer hook.
+const seqFieldName = "_oceanlogtest_seq"
+
+var levels = map[string]oceanlog.Level{
+	"trace":                   oceanlog.LevelTrace,
+	"debug":                   oceanlog.LevelDebug,
+	"info":                    oceanlog.LevelInfo,
+	oceanlog.LevelNoticeValue: oceanlog.LevelNotice,
+	"warn":                    oceanlog.LevelWarn,
+	"error":                   oceanlog.LevelError,
+	"fatal":                   oceanlog.LevelFatal,
+}
+
+// Entry is a record written by the observer logger.
+type Entry struct {
+	Level   oceanlog.Level
+	Message string
+	// Time is the zero time unless the logger has a clock, see WithClock.
+	Time   time.Time
+	Caller string
+	// Fields are the other fields of the record, including those added by the context extractors.
+	Fields map[string]interface{}
+	// Context is the context the record was logged with.
+	Context context.Context
+}
+
+// ContextValue returns the value of key in the context of the entry, or nil.
+func (e Entry) ContextValue(key interface{}) interface{} {
+	if e.Context == nil {
+		return nil
+	}
+	return e.Context.Value(key)
+}
+
+func (e Entry) String() string {
+	return fmt.Sprintf("%s %q %v", levelName(e.Level), e.Message, e.Fields)
+}
+
+type (
+	config struct {
+		clock   *Clock
+		testLog bool
+		options []oceanlog.Opt
+	}
+
+	// Option configures NewObserver.
+	Option func(cfg *config)
+)
+
+// WithClock sets the time of the entries from c, so that timestamps are stable in golden tests.
+// The timestamps are logged in the time.RFC3339Nano format.
+func WithClock(c *Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = c
+	}
+}
+
+// WithoutTestLog disables forwarding the records to t.Log.
+func WithoutTestLog() Option {
+	return func(cfg *config) {
+		cfg.testLog = false
+	}
+}
+
+// WithOptions adds options of the observer logger, e.g. oceanlog.WithLevel.
+func WithOptions(options ...oceanlog.Opt) Option {
+	return func(cfg *config) {
+		cfg.options = append(cfg.options, options...)
+	}
+}
+
+// NewObserver returns a logger at trace level recording its entries in the returned ObservedLogs.
+// Every record is also forwarded to t.Log unless WithoutTestLog is given.
+func NewObserver(t testing.TB, options ...Option) (*oceanlog.DefaultLogger, *ObservedLogs) {
+	l, w := newObserver(t, options...)
+	return l, w.logs
+}
+
+func newObserver(t testing.TB, options ...Option) (*oceanlog.DefaultLogger, *observerWriter) {
+	cfg := &config{testLog: true}
+	for _, set := range options {
+		set(cfg)
+	}
+
+	logs := &ObservedLogs{}
+	w := &observerWriter{logs: logs, contexts: map[uint64]context.Context{}}
+	if cfg.testLog {
+		w.t = t
+		// t.Log panics once the test completed
+		t.Cleanup(func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			w.t = nil
+		})
+	}
+	opts := []oceanlog.Opt{
+		oceanlog.WithOutput(w),
+		oceanlog.WithLevel(oceanlog.LevelTrace),
+		oceanlog.WithCaller(),
+		oceanlog.WithFinalHook(zerolog.HookFunc(w.hook)),
+	}
+	if cfg.clock != nil {
+		opts = append(opts, oceanlog.WithClock(cfg.clock), oceanlog.WithFormattedTimestamp(time.RFC3339Nano))
+	}
+	return oceanlog.New(append(opts, cfg.options...)...), w
+}
+
+type observerWriter struct {
+	t    testing.TB
+	logs *ObservedLogs
+
+	mu       sync.Mutex
+	seq      uint64
+	contexts map[uint64]context.Context
+}
+
+// hook captures the context of each record. It runs after the sampler: the context of a dropped
+// record would never be taken by Write.
+func (w *observerWriter) hook(e *zerolog.Event, level zerolog.Level, message string) {
+	if level == zerolog.Disabled {
+		return
+	}
+	w.mu.Lock()
+	w.seq++
+	seq := w.seq
+	w.contexts[seq] = e.GetCtx()
+	w.mu.Unlock()
+
+	e.Uint64(seqFieldName, seq)
+}
+
+func (w *observerWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	if w.t != nil {
+		w.t.Helper()
+		w.t.Log(strings.TrimSuffix(string(p), "\n"))
+	}
+	w.mu.Unlock()
+
+	fields := map[string]interface{}{}
+	d := json.NewDecoder(bytes.NewReader(p))
+	d.UseNumber()
+	if err := d.Decode(&fields); err != nil {
+		return 0, err
+	}
+
+	e := Entry{Fields: fields}
+	if s, ok := fields[zerolog.LevelFieldName].(string); ok {
+		e.Level = levels[s]
+	}
+	e.Message, _ = fields[zerolog.MessageFieldName].(string)
+	e.Caller, _ = fields[zerolog.CallerFieldName].(string)
+	if s, ok := fields[zerolog.TimestampFieldName].(string); ok {
+		e.Time, _ = time.Parse(time.RFC3339Nano, s)
+	}
+	if n, ok := fields[seqFieldName].(json.Number); ok {
+		seq, _ := n.Int64()
+		w.mu.Lock()
+		e.Context = w.contexts[uint64(seq)]
+		delete(w.contexts, uint64(seq))
+		w.mu.Unlock()
+	}
+	for _, key := range []string{zerolog.LevelFieldName, zerolog.MessageFieldName, zerolog.CallerFieldName,
+		zerolog.TimestampFieldName, seqFieldName} {
+		delete(fields, key)
+	}
+
+	w.logs.add(e)
+	return len(p), nil
+}
+
+// ObservedLogs is a concurrency-safe list of entries.
+type ObservedLogs struct {
+	mu      sync.RWMutex
+	entries []Entry
+}
+
+func (o *ObservedLogs) add(e Entry) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.entries = append(o.entries, e)
+}
+
+// Len returns the number of entries.
+func (o *ObservedLogs) Len() int {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return len(o.entries)
+}
+
+// All returns a copy of the entries.
+func (o *ObservedLogs) All() []Entry {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return append([]Entry(nil), o.entries...)
+}
+
+// TakeAll returns the entries and empties the list.
+func (o *ObservedLogs) TakeAll() []Entry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	entries := o.entries
+	o.entries = nil
+	return entries
+}
+
+// Filter returns the entries matching fn.
+func (o *ObservedLogs) Filter(fn func(Entry) bool) *ObservedLogs {
+	filtered := &ObservedLogs{}
+	for _, e := range o.All() {
+		if fn(e) {
+			filtered.entries = append(filtered.entries, e)
+		}
+	}
+	return filtered
+}
+
+// FilterLevel returns the entries at level.
+func (o *ObservedLogs) FilterLevel(level oceanlog.Level) *ObservedLogs {
+	return o.Filter(func(e Entry) bool { return e.Level == level })
+}
+
+// FilterMessage returns the entries whose message contains substr.
+func (o *ObservedLogs) FilterMessage(substr string) *ObservedLogs {
+	return o.Filter(func(e Entry) bool { return strings.Contains(e.Message, substr) })
+}
+
+// FilterField returns the entries whose field key equals value, compared by their JSON encoding.
+func (o *ObservedLogs) FilterField(key string, value interface{}) *ObservedLogs {
+	return o.Filter(func(e Entry) bool { return fieldEqual(e.Fields, key, value) })
+}
+
+// RequireLogged fails the test unless an entry at level has a message containing msgSubstring
+// and the given fields. fields may be nil.
+func (o *ObservedLogs) RequireLogged(t testing.TB, level oceanlog.Level, msgSubstring string, fields map[string]interface{}) Entry {
+	t.Helper()
+	for _, e := range o.All() {
+		if matches(e, level, msgSubstring, fields) {
+			return e
+		}
+	}
+	t.Fatalf("no %s entry with message containing %q and fields %v, logged:\n%s",
+		levelName(level), msgSubstring, fields, o.dump())
+	return Entry{}
+}
+
+// RequireNotLogged fails the test if an entry at level has a message containing msgSubstring
+// and the given fields. fields may be nil.
+func (o *ObservedLogs) RequireNotLogged(t testing.TB, level oceanlog.Level, msgSubstring string, fields map[string]interface{}) {
+	t.Helper()
+	for _, e := range o.All() {
+		if matches(e, level, msgSubstring, fields) {
+			t.Fatalf("unexpected entry %s", e)
+		}
+	}
+}
+
+func (o *ObservedLogs) dump() string {
+	var sb strings.Builder
+	for _, e := range o.All() {
+		sb.WriteString("\t")
+		sb.WriteString(e.String())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func matches(e Entry, level oceanlog.Level, msgSubstring string, fields map[string]interface{}) bool {
+	if e.Level != level || !strings.Contains(e.Message, msgSubstring) {
+		return false
+	}
+	for key, value := range fields {
+		if !fieldEqual(e.Fields, key, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldEqual compares the field key with value as decoded from JSON, so that 42 matches a logged int64.
+func fieldEqual(fields map[string]interface{}, key string, value interface{}) bool {
+	got, ok := fields[key]
+	if !ok {
+		return false
+	}
+	want, err := normalize(value)
+	if err != nil {
+		return false
+	}
+	have, err := normalize(got)
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(want, have)
+}
+
+func normalize(v interface{}) (interface{}, error) {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	d := json.NewDecoder(bytes.NewReader(p))
+	d.UseNumber()
+	err = d.Decode(&out)
+	return out, err
+}
+
+func levelName(level oceanlog.Level) string {
+	for name, l := range levels {
+		if l == level {
+			return name
+		}
+	}
+	return fmt.Sprint(int(level))
+}
+
+// Clock is a deterministic oceanlog.Clock advancing by a fixed step on every reading.
+type Clock struct {
+	mu   sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+// NewClock returns a clock starting at start and advancing by step after each call to Now.
+func NewClock(start time.Time, step time.Duration) *Clock {
+	return &Clock{now: start, step: step}
+}
+
+// Now returns the current time of the clock and advances it.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+// Set sets the current time of the clock.
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
@@ -0,0 +1,111 @@
+package oceanlogtest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/v-mars/oceanlog"
+)
+
+type userKey struct{}
+
+func TestObserver(t *testing.T) {
+	l, logs := NewObserver(t)
+
+	ctx := context.WithValue(oceanlog.ContextWithRequestID(context.Background(), "req-1"), userKey{}, "alice")
+	l.CtxInfof(ctx, "user %s logged in", "alice")
+	fl := l.WithField("attempt", 3)
+	fl.Notice("slow")
+	l.CtxErrorw(ctx, errors.New("boom"), "failed", "user_id", 42)
+
+	assert.Equal(t, 3, logs.Len())
+	e := logs.RequireLogged(t, oceanlog.LevelInfo, "logged in", map[string]interface{}{"request_id": "req-1"})
+	assert.Equal(t, "alice", e.ContextValue(userKey{}))
+	assert.True(t, strings.HasPrefix(e.Caller, "observer_test.go:") || strings.Contains(e.Caller, "/observer_test.go:"), e.Caller)
+
+	logs.RequireLogged(t, oceanlog.LevelNotice, "slow", map[string]interface{}{"attempt": 3})
+	logs.RequireLogged(t, oceanlog.LevelError, "failed", map[string]interface{}{"user_id": 42, "error.message": "boom"})
+	logs.RequireNotLogged(t, oceanlog.LevelWarn, "", nil)
+
+	assert.Equal(t, 1, logs.FilterLevel(oceanlog.LevelError).Len())
+	assert.Equal(t, 2, logs.FilterField("request_id", "req-1").Len())
+	assert.Equal(t, 1, logs.FilterMessage("slow").FilterField("attempt", 3).Len())
+	assert.Nil(t, logs.FilterMessage("slow").All()[0].ContextValue(userKey{}))
+
+	assert.Len(t, logs.TakeAll(), 3)
+	assert.Equal(t, 0, logs.Len())
+}
+
+func TestObserver_clock(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	l, logs := NewObserver(t, WithClock(NewClock(start, time.Second)), WithoutTestLog())
+
+	l.Info("a")
+	l.Info("b")
+
+	entries := logs.All()
+	assert.Equal(t, start, entries[0].Time)
+	assert.Equal(t, start.Add(time.Second), entries[1].Time)
+}
+
+func TestObserver_options(t *testing.T) {
+	l, logs := NewObserver(t, WithOptions(oceanlog.WithLevel(oceanlog.LevelWarn)))
+
+	l.Info("dropped")
+	l.Warn("kept")
+
+	assert.Equal(t, 1, logs.Len())
+}
+
+func TestObserver_sampled(t *testing.T) {
+	sampler := oceanlog.NewSampler(oceanlog.SamplingConf{Burst: 1, Tick: time.Hour})
+	l, w := newObserver(t, WithOptions(oceanlog.WithSampler(sampler)), WithoutTestLog())
+
+	ctx := context.WithValue(context.Background(), userKey{}, "alice")
+	for i := 0; i < 10; i++ {
+		l.CtxInfof(ctx, "sampled")
+	}
+
+	assert.Equal(t, 1, w.logs.Len())
+	assert.Equal(t, "alice", w.logs.All()[0].ContextValue(userKey{}))
+	// the contexts of the dropped records are not kept
+	assert.Empty(t, w.contexts)
+}
+
+type fakeT struct {
+	testing.TB
+	mu     sync.Mutex
+	logged []string
+	failed string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Log(args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.logged = append(t.logged, args[0].(string))
+}
+
+func (t *fakeT) Cleanup(func()) {}
+
+func (t *fakeT) Fatalf(format string, args ...interface{}) {
+	t.failed = format
+}
+
+func TestObserver_testLog(t *testing.T) {
+	ft := &fakeT{}
+	l, logs := NewObserver(ft)
+
+	l.Info("forwarded")
+	assert.Len(t, ft.logged, 1)
+	assert.Contains(t, ft.logged[0], `"message":"forwarded"`)
+
+	logs.RequireLogged(ft, oceanlog.LevelError, "missing", nil)
+	assert.NotEmpty(t, ft.failed)
+}
@@ -19,14 +19,33 @@ package oceanlog
 import (
 	"github.com/cloudwego/hertz/pkg/common/hlog"
 	"io"
+	"os"
+	"time"
 
 	"github.com/rs/zerolog"
 )
 
 type (
 	Options struct {
-		context zerolog.Context
-		level   zerolog.Level
+		context    zerolog.Context
+		hlevel     Level
+		exit       func(code int)
+		flush      []func() error
+		errorStack bool
+		name       string
+		timestamp  *timestampConf
+		location   *time.Location
+		clock      Clock
+		caller     *callerConf
+		// callerFormat and callerWrappers apply to a caller option given later
+		callerFormat   CallerFormat
+		callerWrappers []string
+		out            io.Writer
+		redactor       *Redactor
+		sampler        *Sampler
+		metrics        Metrics
+		extractors     []ContextExtractor
+		finalHooks     []zerolog.Hook
 	}
 
 	Opt func(opts *Options)
@@ -35,7 +54,8 @@ type (
 func newOptions(log zerolog.Logger, options []Opt) *Options {
 	opts := &Options{
 		context: log.With(),
-		level:   log.GetLevel(),
+		hlevel:  matchZerologLevel(log.GetLevel()),
+		exit:    os.Exit,
 	}
 
 	for _, set := range options {
@@ -49,6 +69,14 @@ func newOptions(log zerolog.Logger, options []Opt) *Options {
 func WithOutput(out io.Writer) Opt {
 	return func(opts *Options) {
 		opts.context = opts.context.Logger().Output(out).With()
+		opts.out = out
+	}
+}
+
+// WithName names the logger, the name is logged as LoggerFieldName. See DefaultLogger.Named.
+func WithName(name string) Opt {
+	return func(opts *Options) {
+		opts.name = name
 	}
 }
 
@@ -57,7 +85,7 @@ func WithLevel(level hlog.Level) Opt {
 	lvl := matchHlogLevel(level)
 	return func(opts *Options) {
 		opts.context = opts.context.Logger().Level(lvl).With()
-		opts.level = lvl
+		opts.hlevel = level
 	}
 }
 
@@ -75,34 +103,95 @@ func WithFields(fields map[string]interface{}) Opt {
 	}
 }
 
-// WithTimestamp adds a timestamp field to the logger's context
+// WithTimestamp adds a timestamp field in the time.RFC3339 format.
 func WithTimestamp() Opt {
+	return WithFormattedTimestamp(time.RFC3339)
+}
+
+// WithFormattedTimestamp adds a timestamp field formatted with the given layout, or as a Unix epoch
+// number with TimeFormatUnix, TimeFormatUnixMs, TimeFormatUnixMicro or TimeFormatUnixNano.
+// Unlike zerolog.TimeFieldFormat the layout only applies to this logger.
+func WithFormattedTimestamp(format string) Opt {
 	return func(opts *Options) {
-		opts.context = opts.context.Timestamp()
+		opts.timestamp = &timestampConf{format: format, loc: opts.location}
 	}
 }
 
-// WithFormattedTimestamp adds a formatted timestamp field to the logger's context
-func WithFormattedTimestamp(format string) Opt {
-	zerolog.TimeFieldFormat = format
+// WithTimestampLocation logs the timestamp in loc. By default, it is the location of the clock, local time for SystemClock.
+func WithTimestampLocation(loc *time.Location) Opt {
+	return func(opts *Options) {
+		opts.location = loc
+		if opts.timestamp != nil {
+			opts.timestamp.loc = loc
+		}
+	}
+}
+
+// WithUTC logs the timestamp in UTC.
+func WithUTC() Opt {
+	return WithTimestampLocation(time.UTC)
+}
+
+// WithLocalTime logs the timestamp in local time.
+func WithLocalTime() Opt {
+	return WithTimestampLocation(time.Local)
+}
+
+// WithClock sets the clock of the timestamps and of the sampling windows. By default, it is SystemClock.
+// The rotation of the log files is out of its scope: lumberjack reads the system time.
+func WithClock(clock Clock) Opt {
 	return func(opts *Options) {
-		opts.context = opts.context.Timestamp()
+		opts.clock = clock
 	}
 }
 
-// WithCaller adds a caller field to the logger's context
+// WithCaller adds a caller field. The frames of this module, its subpackages such as dblog included,
+// zerolog, hlog, database/sql, gorm and the packages of WithCallerWrappers are skipped, so the caller
+// of a wrapper such as the package level Info or of a database query is logged.
 func WithCaller() Opt {
 	return func(opts *Options) {
-		opts.context = opts.context.Caller()
+		opts.caller = &callerConf{skip: callerAuto, format: opts.callerFormat, wrappers: opts.callerWrappers}
+	}
+}
+
+// WithoutCaller removes the caller field, which New adds by default.
+func WithoutCaller() Opt {
+	return func(opts *Options) {
+		opts.caller = nil
 	}
 }
 
-// WithCallerSkipFrameCount adds a caller field to the logger's context
-// The specified skipFrameCount int will override the global CallerSkipFrameCount for this context's respective logger.
-// If set to -1 the global CallerSkipFrameCount will be used.
+// WithCallerSkipFrameCount adds a caller field skipping skipFrameCount frames, counted like zerolog's
+// CallerWithSkipFrameCount. If set to -1 the frames are skipped automatically, see WithCaller.
+//
+// Deprecated: Use WithCaller, which skips the frames of wrappers automatically.
 func WithCallerSkipFrameCount(skipFrameCount int) Opt {
 	return func(opts *Options) {
-		opts.context = opts.context.CallerWithSkipFrameCount(skipFrameCount)
+		if skipFrameCount < 0 {
+			skipFrameCount = callerAuto
+		}
+		opts.caller = &callerConf{skip: skipFrameCount, format: opts.callerFormat, wrappers: opts.callerWrappers}
+	}
+}
+
+// WithCallerFormat sets the format of the caller field, CallerBasename by default.
+func WithCallerFormat(format CallerFormat) Opt {
+	return func(opts *Options) {
+		opts.callerFormat = format
+		if opts.caller != nil {
+			opts.caller.format = format
+		}
+	}
+}
+
+// WithCallerWrappers skips the frames of functions whose name starts with one of prefixes, e.g. the
+// package path "example.com/app/log." of a package wrapping the logger, when looking for the caller.
+func WithCallerWrappers(prefixes ...string) Opt {
+	return func(opts *Options) {
+		opts.callerWrappers = append(opts.callerWrappers, prefixes...)
+		if opts.caller != nil {
+			opts.caller.wrappers = opts.callerWrappers
+		}
 	}
 }
 
@@ -119,3 +208,66 @@ func WithHookFunc(hook zerolog.HookFunc) Opt {
 		opts.context = opts.context.Logger().Hook(hook).With()
 	}
 }
+
+// WithFinalHook adds a hook running after every other hook, including the sampler, so that it does not
+// see the records the sampler drops.
+func WithFinalHook(hook zerolog.Hook) Opt {
+	return func(opts *Options) {
+		opts.finalHooks = append(opts.finalHooks, hook)
+	}
+}
+
+// WithRedactor passes every record through r before it reaches the output,
+// including outputs set later with SetOutput.
+func WithRedactor(r *Redactor) Opt {
+	return func(opts *Options) {
+		opts.redactor = r
+	}
+}
+
+// WithSampler drops records according to the sampler's configuration.
+// It runs after every other hook so that dropped records still reach them.
+func WithSampler(s *Sampler) Opt {
+	return func(opts *Options) {
+		opts.sampler = s
+	}
+}
+
+// WithMetrics counts the records per level and logger name, and the sampled and redacted ones, in m.
+func WithMetrics(m Metrics) Opt {
+	return func(opts *Options) {
+		opts.metrics = m
+	}
+}
+
+// WithContextExtractor adds the fields extracted by e to every record logged with a context.
+// Extractors run in the order they were added, after those New registers by default:
+// RequestIDExtractor and ContextFieldsExtractor. A key extracted several times is logged once,
+// with the value of the last extractor.
+func WithContextExtractor(e ContextExtractor) Opt {
+	return func(opts *Options) {
+		opts.extractors = append(opts.extractors, e)
+	}
+}
+
+// WithExitFunc sets the function called with exit code 1 after a fatal record. By default, it is os.Exit.
+func WithExitFunc(exit func(code int)) Opt {
+	return func(opts *Options) {
+		opts.exit = exit
+	}
+}
+
+// WithFlush adds a function DefaultLogger.Flush runs, e.g. to close a lumberjack.Logger before exiting.
+func WithFlush(flush func() error) Opt {
+	return func(opts *Options) {
+		opts.flush = append(opts.flush, flush)
+	}
+}
+
+// WithErrorStack captures the stack trace at log time for errors logged with WithError or CtxErrorw
+// that do not carry one.
+func WithErrorStack() Opt {
+	return func(opts *Options) {
+		opts.errorStack = true
+	}
+}
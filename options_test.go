@@ -18,19 +18,23 @@ package oceanlog
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/cloudwego/hertz/pkg/common/hlog"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestWithOutput(t *testing.T) {
 	b := &bytes.Buffer{}
-	l := New(WithOutput(b))
+	l := New(WithOutput(b), WithoutCaller())
 
 	l.Info("foobar")
 
@@ -64,15 +68,29 @@ func TestWithCaller(t *testing.T) {
 	segments := strings.Split(log.Caller, ":")
 	filePath := filepath.Base(segments[0])
 
-	assert.Equal(t, filePath, "logger.go")
+	assert.Equal(t, "options_test.go", filePath)
+}
+
+func TestWithoutCaller(t *testing.T) {
+	b := &bytes.Buffer{}
+	New(WithOutput(b)).Info("foo")
+	New(WithOutput(b), WithoutCaller()).Info("foo")
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		// New adds the caller by default
+		assert.Regexp(t, `^\{"level":"info","caller":"options_test.go:\d+","message":"foo"\}$`, lines[0])
+		assert.Equal(t, `{"level":"info","message":"foo"}`, lines[1])
+	}
 }
 
 func TestWithCallerSkipFrameCount(t *testing.T) {
 	b := &bytes.Buffer{}
 	l := New(WithCallerSkipFrameCount(5))
 	l.SetOutput(b)
-	//hlog.SetLogger(l)
-	//hlog.Info("foobar")
+	defer hlog.SetLogger(hlog.DefaultLogger())
+	hlog.SetLogger(l)
+	hlog.Info("foobar")
 
 	type Log struct {
 		Level   string `json:"level"`
@@ -196,7 +214,7 @@ func TestWithHookFunc(t *testing.T) {
 
 func TestWithLevel(t *testing.T) {
 	b := &bytes.Buffer{}
-	l := New(WithLevel(LevelInfo))
+	l := New(WithLevel(LevelInfo), WithoutCaller())
 	l.SetOutput(b)
 
 	l.Debug("Test")
@@ -243,3 +261,115 @@ func TestWithFormattedTimestamp(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, log.Time)
 }
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestWithClock(t *testing.T) {
+	now := fixedClock(time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.FixedZone("CST", 8*3600)))
+	b1, b2 := &bytes.Buffer{}, &bytes.Buffer{}
+	l1 := New(WithOutput(b1), WithClock(now), WithFormattedTimestamp(time.RFC3339Nano), WithoutCaller())
+	l2 := New(WithOutput(b2), WithClock(now), WithFormattedTimestamp("2006-01-02 15:04:05"), WithUTC(), WithoutCaller())
+
+	l1.Info("foo")
+	l2.Info("foo")
+
+	assert.Equal(t, `{"level":"info","time":"2024-05-06T07:08:09.123456789+08:00","message":"foo"}
+`, b1.String())
+	assert.Equal(t, `{"level":"info","time":"2024-05-05 23:08:09","message":"foo"}
+`, b2.String())
+}
+
+func TestWithFormattedTimestamp_location(t *testing.T) {
+	now := fixedClock(time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC))
+	loc := time.FixedZone("UTC-5", -5*3600)
+	b := &bytes.Buffer{}
+	// the location applies whatever the order of the options
+	l := New(WithOutput(b), WithTimestampLocation(loc), WithClock(now), WithFormattedTimestamp(time.RFC3339), WithoutCaller())
+
+	l.Info("foo")
+
+	assert.Equal(t, `{"level":"info","time":"2024-05-06T02:08:09-05:00","message":"foo"}
+`, b.String())
+}
+
+func TestWithFormattedTimestamp_first(t *testing.T) {
+	now := fixedClock(time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC))
+	b := &bytes.Buffer{}
+	hook := zerolog.HookFunc(func(e *zerolog.Event, level zerolog.Level, message string) { e.Str("hooked", "x") })
+	l := New(WithOutput(b), WithHook(hook), WithClock(now), WithFormattedTimestamp(time.RFC3339), WithoutCaller())
+
+	l.CtxInfof(ContextWithRequestID(context.Background(), "req-1"), "foo")
+
+	// the time precedes the fields of the hooks and extractors, as when it was a context field
+	assert.Equal(t, `{"level":"info","time":"2024-05-06T07:08:09Z","hooked":"x","request_id":"req-1","message":"foo"}
+`, b.String())
+}
+
+func TestWithFormattedTimestamp_unix(t *testing.T) {
+	now := fixedClock(time.Unix(1700000000, 123456789))
+	for format, want := range map[string]string{
+		TimeFormatUnix:      "1700000000",
+		TimeFormatUnixMs:    "1700000000123",
+		TimeFormatUnixMicro: "1700000000123456",
+		TimeFormatUnixNano:  "1700000000123456789",
+	} {
+		b := &bytes.Buffer{}
+		New(WithOutput(b), WithClock(now), WithFormattedTimestamp(format), WithoutCaller()).Info("foo")
+		assert.Equal(t, `{"level":"info","time":`+want+`,"message":"foo"}
+`, b.String())
+	}
+}
+
+func TestWithCallerFormat(t *testing.T) {
+	b := &bytes.Buffer{}
+	_, file, line, _ := runtime.Caller(0)
+	line += 11
+
+	for format, want := range map[CallerFormat]string{
+		CallerBasename:       "options_test.go",
+		CallerModuleRelative: "options_test.go",
+		CallerFullPath:       file,
+		CallerFunction:       "oceanlog.TestWithCallerFormat",
+	} {
+		b.Reset()
+		l := New(WithOutput(b), WithCallerFormat(format), WithCaller())
+		l.Info("foo")
+
+		assert.Equal(t, fmt.Sprintf(`{"level":"info","caller":"%s:%d","message":"foo"}
+`, want, line), b.String())
+	}
+}
+
+func TestWithCaller_packageLevel(t *testing.T) {
+	b := &bytes.Buffer{}
+	defer ReplaceGlobal(New(WithOutput(b), WithCaller()), WithHlog())()
+
+	_, _, line, _ := runtime.Caller(0)
+	Info("foo")
+	CtxInfof(context.Background(), "foo")
+	hlog.CtxInfof(context.Background(), "foo")
+
+	want := fmt.Sprintf(`{"level":"info","caller":"options_test.go:%d","message":"foo"}
+{"level":"info","caller":"options_test.go:%d","message":"foo"}
+{"level":"info","caller":"options_test.go:%d","message":"foo"}
+`, line+1, line+2, line+3)
+	assert.Equal(t, want, b.String())
+}
+
+func TestWithCallerWrappers(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := New(WithOutput(b), WithCaller(), WithCallerFormat(CallerFunction),
+		WithCallerWrappers("github.com/v-mars/oceanlog.logWrapper"))
+
+	_, _, line, _ := runtime.Caller(0)
+	logWrapper(l)
+
+	assert.Equal(t, fmt.Sprintf(`{"level":"info","caller":"oceanlog.TestWithCallerWrappers:%d","message":"foo"}
+`, line+1), b.String())
+}
+
+func logWrapper(l *DefaultLogger) {
+	l.Info("foo")
+}
@@ -0,0 +1,143 @@
+package oceanlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// record is a JSON record decoded for the sinks.
+type record struct {
+	// level is the level field, e.g. "notice", or the level the record was written with
+	level   string
+	message string
+	// time is the timestamp of the record, zero when missing or unparsable
+	time time.Time
+	// fields are the other fields except the timestamp, in order
+	fields []recordField
+	// json is false if the record is not a JSON object, message is then the whole record
+	json bool
+}
+
+type recordField struct {
+	key   string
+	value json.RawMessage
+}
+
+// String returns the value as text: strings unquoted, other values in JSON.
+func (f recordField) String() string {
+	if len(f.value) > 0 && f.value[0] == '"' {
+		var s string
+		if json.Unmarshal(f.value, &s) == nil {
+			return s
+		}
+	}
+	return string(f.value)
+}
+
+// parseRecord decodes p, written at level. Records that are not JSON objects keep their text as message.
+func parseRecord(p []byte, level zerolog.Level) record {
+	r := record{}
+	if level != zerolog.NoLevel {
+		r.level = level.String()
+	}
+	p = bytes.TrimRight(p, "\r\n")
+
+	d := json.NewDecoder(bytes.NewReader(p))
+	if t, err := d.Token(); err != nil || t != json.Delim('{') {
+		r.message = string(p)
+		return r
+	}
+	var fields []recordField
+	for d.More() {
+		t, err := d.Token()
+		if err != nil {
+			r.message = string(p)
+			return r
+		}
+		key, _ := t.(string)
+		var value json.RawMessage
+		if err := d.Decode(&value); err != nil {
+			r.message = string(p)
+			return r
+		}
+		switch key {
+		case zerolog.LevelFieldName:
+			_ = json.Unmarshal(value, &r.level)
+		case zerolog.MessageFieldName:
+			_ = json.Unmarshal(value, &r.message)
+		case zerolog.TimestampFieldName:
+			var v interface{}
+			td := json.NewDecoder(bytes.NewReader(value))
+			td.UseNumber()
+			if td.Decode(&v) == nil {
+				r.time = recordTime(v)
+			}
+		default:
+			fields = append(fields, recordField{key: key, value: value})
+		}
+	}
+	r.fields = fields
+	r.json = true
+	return r
+}
+
+// timeOr returns the timestamp of r, or now() when the record has none, so that a record replayed
+// from a spool keeps the time it was logged at.
+func (r record) timeOr(now func() time.Time) time.Time {
+	if !r.time.IsZero() {
+		return r.time
+	}
+	return now()
+}
+
+// recordTimeLayouts are the layouts of the string timestamps, after zerolog.TimeFieldFormat.
+// The layouts without zone are parsed in local time, like the "2006-01-02 15:04:05" of LogConf.
+var recordTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// recordTime returns the time of the timestamp value v, a string or a json.Number of Unix seconds,
+// milliseconds, microseconds or nanoseconds told apart by their magnitude. It returns the zero time
+// when v cannot be parsed.
+func recordTime(v interface{}) time.Time {
+	switch v := v.(type) {
+	case string:
+		for _, layout := range append([]string{zerolog.TimeFieldFormat}, recordTimeLayouts...) {
+			if layout == "" || strings.HasPrefix(layout, "UNIX") {
+				continue
+			}
+			if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+				return t
+			}
+		}
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			f, err := v.Float64()
+			if err != nil {
+				return time.Time{}
+			}
+			sec, frac := math.Modf(f)
+			return time.Unix(int64(sec), int64(math.Round(frac*1e9)))
+		}
+		switch abs := max(n, -n); {
+		case abs < 1e11:
+			return time.Unix(n, 0)
+		case abs < 1e14:
+			return time.UnixMilli(n)
+		case abs < 1e17:
+			return time.UnixMicro(n)
+		default:
+			return time.Unix(0, n)
+		}
+	}
+	return time.Time{}
+}
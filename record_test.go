@@ -0,0 +1,37 @@
+package oceanlog
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRecord_time(t *testing.T) {
+	at := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	for _, tt := range []struct {
+		record string
+		want   time.Time
+	}{
+		{`{"time":"2024-05-06T07:08:09Z"}`, at},
+		{`{"time":"2024-05-06T15:08:09.5+08:00"}`, at.Add(500 * time.Millisecond)},
+		{`{"time":"2024-05-06 07:08:09"}`, time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local)},
+		{`{"time":1714979289}`, at},
+		{`{"time":1714979289123}`, at.Add(123 * time.Millisecond)},
+		{`{"time":1714979289123456}`, at.Add(123456 * time.Microsecond)},
+		{`{"time":1714979289123456789}`, at.Add(123456789)},
+		{`{"time":1714979289.25}`, at.Add(250 * time.Millisecond)},
+		{`{"time":"yesterday"}`, time.Time{}},
+		{`{"message":"no time"}`, time.Time{}},
+		{`not json`, time.Time{}},
+	} {
+		r := parseRecord([]byte(tt.record), zerolog.InfoLevel)
+		assert.True(t, tt.want.Equal(r.time), "%s: %v", tt.record, r.time)
+	}
+
+	now := func() time.Time { return at }
+	assert.Equal(t, at, parseRecord([]byte(`{"message":"no time"}`), zerolog.InfoLevel).timeOr(now))
+	assert.Equal(t, time.Time{}, recordTime(json.Number("abc")))
+}
@@ -0,0 +1,121 @@
+package oceanlog
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// PanicError is the error logged for a recovered panic. It carries the stack of the panic.
+type PanicError struct {
+	Value interface{}
+	pcs   []uintptr
+}
+
+// Error implements error.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Callers returns the stack of the panic, see WithError.
+func (e *PanicError) Callers() []uintptr {
+	return e.pcs
+}
+
+// newPanicError returns the PanicError of v, called by the function deferred during the panic.
+func newPanicError(v interface{}) *PanicError {
+	var pcs [64]uintptr
+	n := runtime.Callers(1, pcs[:])
+	// drop the frames up to runtime.gopanic and the runtime frames raising the panic, e.g. runtime.sigpanic
+	start := 0
+	for i, pc := range pcs[:n] {
+		if fn := runtime.FuncForPC(pc - 1); fn != nil && fn.Name() == "runtime.gopanic" {
+			start = i + 1
+			break
+		}
+	}
+	for start < n {
+		fn := runtime.FuncForPC(pcs[start] - 1)
+		if fn == nil || !strings.HasPrefix(fn.Name(), "runtime.") {
+			break
+		}
+		start++
+	}
+	return &PanicError{Value: v, pcs: append([]uintptr(nil), pcs[start:n]...)}
+}
+
+type (
+	recoverOptions struct {
+		level   Level
+		repanic bool
+	}
+
+	// RecoverOpt configures Recover, Go and RecoveryMiddleware.
+	RecoverOpt func(opts *recoverOptions)
+)
+
+// WithPanicLevel sets the level of recovered panics, LevelError by default.
+// At LevelFatal the exit function of the logger is called once the panic is logged.
+func WithPanicLevel(level Level) RecoverOpt {
+	return func(opts *recoverOptions) {
+		opts.level = level
+	}
+}
+
+// WithRepanic panics again with the recovered value once it is logged and the outputs are flushed.
+func WithRepanic() RecoverOpt {
+	return func(opts *recoverOptions) {
+		opts.repanic = true
+	}
+}
+
+func newRecoverOptions(options []RecoverOpt) *recoverOptions {
+	opts := &recoverOptions{level: LevelError}
+	for _, set := range options {
+		set(opts)
+	}
+	return opts
+}
+
+// Recover logs a panic of the calling goroutine with l, or the default logger if l is nil,
+// together with its stack and the fields of ctx, then flushes the outputs.
+// It must be deferred directly:
+//
+//	defer oceanlog.Recover(ctx, l)
+func Recover(ctx context.Context, l *DefaultLogger, options ...RecoverOpt) {
+	if v := recover(); v != nil {
+		handlePanic(ctx, l, v, newRecoverOptions(options))
+	}
+}
+
+// Go runs fn in a new goroutine that recovers and logs its panics with the default logger, see Recover.
+func Go(ctx context.Context, fn func(ctx context.Context), options ...RecoverOpt) {
+	GetDefaultLogger().Go(ctx, fn, options...)
+}
+
+// Go runs fn in a new goroutine that recovers and logs its panics with l, see Recover.
+func (l *DefaultLogger) Go(ctx context.Context, fn func(ctx context.Context), options ...RecoverOpt) {
+	go func() {
+		defer Recover(ctx, l, options...)
+		fn(ctx)
+	}()
+}
+
+// handlePanic logs the recovered value v and panics again if configured.
+func handlePanic(ctx context.Context, l *DefaultLogger, v interface{}, opts *recoverOptions) {
+	if l == nil {
+		l = GetDefaultLogger()
+	}
+	l.CtxLogw(opts.level, ctx, newPanicError(v), "panic recovered")
+	_ = l.Flush()
+	if opts.repanic {
+		panic(v)
+	}
+}
@@ -0,0 +1,117 @@
+package oceanlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+)
+
+type panicLog struct {
+	Level      string `json:"level"`
+	Message    string `json:"message"`
+	RequestID  string `json:"request_id"`
+	ErrMessage string `json:"error.message"`
+	Stack      string `json:"error.stack_trace"`
+}
+
+func decodePanicLog(t *testing.T, line string) panicLog {
+	var lo panicLog
+	assert.NoError(t, json.Unmarshal([]byte(line), &lo))
+	return lo
+}
+
+func panicking() {
+	var m map[string]int
+	m["x"] = 1
+}
+
+func TestRecover(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b))
+
+	func() {
+		defer Recover(ContextWithRequestID(context.Background(), "req-1"), l)
+		panicking()
+	}()
+
+	lines := b.Lines()
+	if assert.Len(t, lines, 1) {
+		lo := decodePanicLog(t, lines[0])
+		assert.Equal(t, "error", lo.Level)
+		assert.Equal(t, "panic recovered", lo.Message)
+		assert.Equal(t, "req-1", lo.RequestID)
+		assert.Equal(t, "panic: assignment to entry in nil map", lo.ErrMessage)
+		assert.Regexp(t, `^github.com/v-mars/oceanlog.panicking\n`, lo.Stack)
+	}
+}
+
+func TestRecover_repanic(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b))
+	boom := errors.New("boom")
+
+	assert.PanicsWithValue(t, boom, func() {
+		defer Recover(context.Background(), l, WithRepanic())
+		panic(boom)
+	})
+	assert.Len(t, b.Lines(), 1)
+}
+
+func TestRecover_fatal(t *testing.T) {
+	b := &syncBuffer{}
+	code := 0
+	l := New(WithOutput(b), WithExitFunc(func(c int) { code = c }))
+
+	func() {
+		defer Recover(context.Background(), l, WithPanicLevel(LevelFatal))
+		panic("boom")
+	}()
+
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "fatal", decodePanicLog(t, b.Lines()[0]).Level)
+}
+
+func TestGo(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b))
+	done := make(chan struct{})
+
+	l.Go(context.Background(), func(ctx context.Context) {
+		defer close(done)
+		panic("boom")
+	})
+	<-done
+
+	assert.Eventually(t, func() bool { return len(b.Lines()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, "panic: boom", decodePanicLog(t, b.Lines()[0]).ErrMessage)
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b))
+
+	engine := route.NewEngine(config.NewOptions(nil))
+	engine.Use(RecoveryMiddleware(l))
+	engine.GET("/", func(ctx context.Context, c *app.RequestContext) {
+		panic("boom")
+	})
+
+	w := ut.PerformRequest(engine, "GET", "/", nil, ut.Header{Key: ReqIDKey, Value: "req-2"})
+	resp := w.Result()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode())
+	assert.JSONEq(t, `{"error":"Internal Server Error","request_id":"req-2"}`, string(resp.Body()))
+
+	lines := b.Lines()
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, "req-2", decodePanicLog(t, lines[0]).RequestID)
+	}
+}
@@ -0,0 +1,384 @@
+package oceanlog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// DefaultMask replaces sensitive values unless RedactConf.Mask is set.
+const DefaultMask = "******"
+
+// Built-in value patterns that can be enabled by name through RedactConf.Builtin.
+const (
+	RedactEmail = "email"
+	RedactCard  = "card"
+	RedactJWT   = "jwt"
+	RedactPhone = "phone"
+)
+
+var builtinPatterns = map[string]valuePattern{
+	RedactEmail: {
+		re:   regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		hint: func(s string) bool { return strings.IndexByte(s, '@') >= 0 },
+	},
+	RedactCard: {
+		re:   regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		hint: func(s string) bool { return countDigits(s) >= 13 },
+	},
+	RedactJWT: {
+		re:   regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+		hint: func(s string) bool { return strings.Contains(s, "eyJ") },
+	},
+	RedactPhone: {
+		re:   regexp.MustCompile(`(?:\+\d{1,3}[ -]?)?\b1[3-9]\d{9}\b|\+\d{1,3}[ -]?\d{6,14}\b`),
+		hint: func(s string) bool { return countDigits(s) >= 7 },
+	},
+}
+
+// valuePattern is a regular expression with a cheap check that must pass before it is run.
+type valuePattern struct {
+	re   *regexp.Regexp
+	hint func(s string) bool
+}
+
+func countDigits(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+// RedactConf configures a Redactor.
+type RedactConf struct {
+	Keys     []string `json:"keys"`      // field names or globs such as "*token*", case-insensitive
+	Patterns []string `json:"patterns"`  // regular expressions matched against string values
+	Builtin  []string `json:"builtin"`   // email、card、jwt、phone
+	Hash     bool     `json:"hash"`      // replace with a sha256 digest instead of the mask
+	HashSalt string   `json:"hash_salt"` // salt prepended to values before hashing
+	Mask     string   `json:"mask"`      // ******
+}
+
+// Redactor masks sensitive fields and values of JSON log records.
+// Records that are not JSON, e.g. console or logrus text output, only get values masked.
+type Redactor struct {
+	conf     RedactConf
+	keys     map[string]struct{}
+	globs    []string
+	inline   *regexp.Regexp // key=value pairs embedded in strings
+	patterns []valuePattern
+	card     *valuePattern
+	// all masks every value but the level and the time, see maskAll
+	all bool
+}
+
+// NewRedactor compiles conf into a Redactor.
+func NewRedactor(conf RedactConf) (*Redactor, error) {
+	r := &Redactor{conf: conf, keys: map[string]struct{}{}}
+	if r.conf.Mask == "" {
+		r.conf.Mask = DefaultMask
+	}
+
+	var inline []string
+	for _, k := range conf.Keys {
+		k = strings.ToLower(k)
+		if strings.ContainsAny(k, "*?[") {
+			if _, err := path.Match(k, ""); err != nil {
+				return nil, err
+			}
+			r.globs = append(r.globs, k)
+		} else {
+			r.keys[k] = struct{}{}
+		}
+		inline = append(inline, globToRegexp(k))
+	}
+	if len(inline) > 0 {
+		r.inline = regexp.MustCompile(`(?i)\b(` + strings.Join(inline, "|") + `)(\s*[=:]\s*)("[^"]*"|[^\s,;&"]+)`)
+	}
+
+	for _, name := range conf.Builtin {
+		p, ok := builtinPatterns[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown builtin redact pattern %q", name)
+		}
+		if name == RedactCard {
+			r.card = &p
+			continue
+		}
+		r.patterns = append(r.patterns, p)
+	}
+	for _, expr := range conf.Patterns {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		r.patterns = append(r.patterns, valuePattern{re: re})
+	}
+	return r, nil
+}
+
+// maskAll returns a Redactor masking every value but the level and the time of the records,
+// which stands in for a RedactConf that does not compile.
+func maskAll(conf RedactConf) *Redactor {
+	mask := conf.Mask
+	if mask == "" {
+		mask = DefaultMask
+	}
+	return &Redactor{conf: RedactConf{Mask: mask}, all: true}
+}
+
+// MustNewRedactor is like NewRedactor but panics on an invalid conf.
+func MustNewRedactor(conf RedactConf) *Redactor {
+	r, err := NewRedactor(conf)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// globToRegexp turns a key glob into a regular expression matching a key inside a message.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for _, c := range glob {
+		switch c {
+		case '*':
+			b.WriteString(`[\w.-]*`)
+		case '?':
+			b.WriteString(`[\w.-]`)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+func (r *Redactor) matchKey(key string) bool {
+	if r.all {
+		return key != zerolog.LevelFieldName && key != zerolog.TimestampFieldName
+	}
+	key = strings.ToLower(key)
+	if _, ok := r.keys[key]; ok {
+		return true
+	}
+	for _, g := range r.globs {
+		if ok, _ := path.Match(g, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) replace(v string) string {
+	if !r.conf.Hash {
+		return r.conf.Mask
+	}
+	sum := sha256.Sum256([]byte(r.conf.HashSalt + v))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// RedactString masks every sensitive value found in s, including key=value pairs.
+func (r *Redactor) RedactString(s string) string {
+	if r.all {
+		return r.replace(s)
+	}
+	if r.inline != nil && strings.ContainsAny(s, "=:") {
+		s = r.inline.ReplaceAllStringFunc(s, func(m string) string {
+			sub := r.inline.FindStringSubmatch(m)
+			return sub[1] + sub[2] + r.replace(strings.Trim(sub[3], `"`))
+		})
+	}
+	for _, p := range r.patterns {
+		if p.hint == nil || p.hint(s) {
+			s = p.re.ReplaceAllStringFunc(s, r.replace)
+		}
+	}
+	if r.card != nil && r.card.hint(s) {
+		s = r.card.re.ReplaceAllStringFunc(s, func(m string) string {
+			if !luhn(m) {
+				return m
+			}
+			return r.replace(m)
+		})
+	}
+	return s
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum used by card numbers.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// Redact returns the redacted form of one record.
+func (r *Redactor) Redact(p []byte) []byte {
+	trimmed := bytes.TrimRight(p, "\r\n")
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		if r.all {
+			return append([]byte(r.replace(string(trimmed))), p[len(trimmed):]...)
+		}
+		return []byte(r.RedactString(string(p)))
+	}
+
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buf)
+	buf.Reset()
+	if err := r.redactJSON(buf, json.RawMessage(trimmed)); err != nil {
+		if r.all {
+			return append([]byte(r.replace(string(trimmed))), p[len(trimmed):]...)
+		}
+		return []byte(r.RedactString(string(p)))
+	}
+	buf.Write(p[len(trimmed):])
+	return append([]byte(nil), buf.Bytes()...)
+}
+
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func (r *Redactor) redactJSON(buf *bytes.Buffer, raw json.RawMessage) error {
+	switch raw[0] {
+	case '{':
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		buf.WriteByte('{')
+		for i := 0; dec.More(); i++ {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := tok.(string)
+			var value json.RawMessage
+			if err = dec.Decode(&value); err != nil {
+				return err
+			}
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, key)
+			buf.WriteByte(':')
+			if r.matchKey(key) {
+				var s string
+				if json.Unmarshal(value, &s) != nil {
+					s = string(value)
+				}
+				writeJSONString(buf, r.replace(s))
+				continue
+			}
+			if r.all {
+				buf.Write(value)
+				continue
+			}
+			if err = r.redactJSON(buf, value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case '[':
+		var values []json.RawMessage
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return err
+		}
+		buf.WriteByte('[')
+		for i, v := range values {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := r.redactJSON(buf, v); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case '"':
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		if redacted := r.RedactString(s); redacted != s {
+			writeJSONString(buf, redacted)
+			return nil
+		}
+		buf.Write(raw)
+	default:
+		buf.Write(raw)
+	}
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	buf.Truncate(buf.Len() - 1) // Encode appends a newline
+}
+
+// Wrap returns a writer that redacts every record before it reaches w.
+func (r *Redactor) Wrap(w io.Writer) io.Writer {
+	if w == nil {
+		return nil
+	}
+	return &redactWriter{r: r, w: w}
+}
+
+type redactWriter struct {
+	r *Redactor
+	w io.Writer
+	// metrics counts the redacted records, if not nil
+	metrics Metrics
+}
+
+var _ zerolog.LevelWriter = (*redactWriter)(nil)
+
+func (rw *redactWriter) redact(p []byte) []byte {
+	redacted := rw.r.Redact(p)
+	if rw.metrics != nil && !bytes.Equal(redacted, p) {
+		rw.metrics.Redacted()
+	}
+	return redacted
+}
+
+func (rw *redactWriter) Write(p []byte) (int, error) {
+	if _, err := rw.w.Write(rw.redact(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (rw *redactWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	lw, ok := rw.w.(zerolog.LevelWriter)
+	if !ok {
+		return rw.Write(p)
+	}
+	if _, err := lw.WriteLevel(level, rw.redact(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
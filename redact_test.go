@@ -0,0 +1,148 @@
+package oceanlog
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactor_Keys(t *testing.T) {
+	b := &bytes.Buffer{}
+	r := MustNewRedactor(RedactConf{Keys: []string{"password", "*token*"}})
+	l := New(WithOutput(b), WithRedactor(r), WithoutCaller()).WithField("password", "hunter2")
+	l = l.WithField("AccessToken", "abc")
+	l = l.WithField("user", "bob")
+	l.Info("login")
+
+	assert.Equal(
+		t,
+		`{"level":"info","password":"******","AccessToken":"******","user":"bob","message":"login"}
+`,
+		b.String(),
+	)
+}
+
+func TestRedactor_Message(t *testing.T) {
+	b := &bytes.Buffer{}
+	r := MustNewRedactor(RedactConf{Keys: []string{"password"}, Builtin: []string{RedactEmail, RedactCard, RedactJWT, RedactPhone}})
+	l := New(WithOutput(b), WithRedactor(r), WithoutCaller())
+
+	l.Infof("user %s password=%s card %s phone %s token %s",
+		"bob@example.com", "hunter2", "4111 1111 1111 1111", "13812345678", "eyJhbGciOi.eyJzdWIiOi.c2lnbmF0dXJl")
+
+	assert.Equal(
+		t,
+		`{"level":"info","message":"user ****** password=****** card ****** phone ****** token ******"}
+`,
+		b.String(),
+	)
+}
+
+func TestRedactor_CardLuhn(t *testing.T) {
+	r := MustNewRedactor(RedactConf{Builtin: []string{RedactCard}})
+
+	assert.Equal(t, "order 1234567890123", r.RedactString("order 1234567890123"))
+	assert.Equal(t, "card ******", r.RedactString("card 4111-1111-1111-1111"))
+}
+
+func TestRedactor_Hash(t *testing.T) {
+	r := MustNewRedactor(RedactConf{Keys: []string{"email"}, Hash: true, HashSalt: "s"})
+
+	a := string(r.Redact([]byte(`{"email":"bob@example.com"}` + "\n")))
+	b := string(r.Redact([]byte(`{"email":"bob@example.com"}` + "\n")))
+
+	assert.Equal(t, a, b)
+	assert.True(t, strings.HasPrefix(a, `{"email":"sha256:`))
+	assert.NotContains(t, a, "bob@example.com")
+}
+
+func TestRedactor_Nested(t *testing.T) {
+	r := MustNewRedactor(RedactConf{Keys: []string{"secret"}, Patterns: []string{`\bid-\d+\b`}})
+
+	assert.Equal(
+		t,
+		`{"a":{"secret":"******","list":["******",1,true]},"b":null}`+"\n",
+		string(r.Redact([]byte(`{"a":{"secret":{"x":1},"list":["id-42",1,true]},"b":null}`+"\n"))),
+	)
+}
+
+func TestRedactor_Text(t *testing.T) {
+	r := MustNewRedactor(RedactConf{Keys: []string{"password"}})
+
+	assert.Equal(
+		t,
+		"time=now level=info msg=\"login password=******\"\n",
+		string(r.Redact([]byte("time=now level=info msg=\"login password=hunter2\"\n"))),
+	)
+}
+
+func TestRedactor_SetOutput(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := New(WithRedactor(MustNewRedactor(RedactConf{Builtin: []string{RedactEmail}})), WithoutCaller())
+	l.SetOutput(b)
+
+	l.Info("bob@example.com")
+
+	assert.Equal(t, `{"level":"info","message":"******"}
+`, b.String())
+}
+
+func TestNewRedactor_invalid(t *testing.T) {
+	_, err := NewRedactor(RedactConf{Builtin: []string{"ssn"}})
+	assert.Error(t, err)
+
+	_, err = NewRedactor(RedactConf{Patterns: []string{"("}})
+	assert.Error(t, err)
+}
+
+func BenchmarkLogger_noRedactor(b *testing.B) {
+	l := New(WithOutput(io.Discard))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Infof("user %s logged in with password=%s", "bob@example.com", "hunter2")
+	}
+}
+
+func BenchmarkLogger_redactor(b *testing.B) {
+	r := MustNewRedactor(RedactConf{
+		Keys:    []string{"password", "*token*"},
+		Builtin: []string{RedactEmail, RedactCard, RedactJWT, RedactPhone},
+	})
+	l := New(WithOutput(io.Discard), WithRedactor(r), WithField("service", "api"))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Infof("user %s logged in with password=%s", "bob@example.com", "hunter2")
+	}
+}
+
+func TestLogConf_invalidRedact(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.log")
+	c := NewDefaultLogger(file, "info",
+		WithRedact(RedactConf{Keys: []string{"password"}, Patterns: []string{"("}}))
+	c.Stdout = false
+
+	// the invalid configuration is reported instead of panicking, and fails closed
+	assert.NotPanics(t, func() {
+		l := c.GetOceanLog().WithField("password", "hunter2")
+		l.Infof("login password=%s", "hunter2")
+	})
+	assert.NotPanics(t, func() { c.GetLogrusLog().WithField("token", "hunter2").Info("hunter2") })
+
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "hunter2")
+	assert.Contains(t, string(data), DefaultMask)
+}
+
+func TestMaskAll(t *testing.T) {
+	r := maskAll(RedactConf{Mask: "x"})
+
+	assert.Equal(t, `{"level":"info","time":1,"user":"x","n":"x","nested":"x","message":"x"}`+"\n",
+		string(r.Redact([]byte(`{"level":"info","time":1,"user":"bob","n":42,"nested":{"a":"b"},"message":"hi"}`+"\n"))))
+	assert.Equal(t, "x\n", string(r.Redact([]byte("password=hunter2\n"))))
+}
@@ -0,0 +1,208 @@
+package oceanlog
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// SamplingConf configures a Sampler. Zero values disable the respective stage.
+type SamplingConf struct {
+	Tick         time.Duration `json:"tick"`          // 采样窗口，默认 1s
+	First        int           `json:"first"`         // 每个窗口内相同 level+message 先输出 First 条
+	Thereafter   int           `json:"thereafter"`    // 之后每 Thereafter 条输出 1 条，0 表示全部丢弃
+	Burst        int           `json:"burst"`         // 每个窗口内每个 level 最多输出 Burst 条
+	Rate         float64       `json:"rate"`          // 每个调用位置每秒输出条数（令牌桶）
+	RateBurst    int           `json:"rate_burst"`    // 令牌桶容量，默认等于 Rate
+	ExemptErrors bool          `json:"exempt_errors"` // Error 和 Fatal 不参与采样
+}
+
+var _ zerolog.Hook = (*Sampler)(nil)
+
+// Sampler is a zerolog.Hook that drops records according to SamplingConf.
+// Suppressed records are summarised by a single warn record at the end of the window they occurred in.
+type Sampler struct {
+	conf SamplingConf
+	now  func() time.Time
+	emit func(suppressed int, from, to time.Time)
+
+	mu          sync.Mutex
+	windowStart time.Time
+	messages    map[sampleKey]int
+	levels      map[zerolog.Level]int
+	buckets     map[uintptr]*tokenBucket
+	suppressed  int
+	since       time.Time
+	timer       *time.Timer
+}
+
+type sampleKey struct {
+	level   zerolog.Level
+	message string
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewSampler returns a Sampler for conf.
+func NewSampler(conf SamplingConf) *Sampler {
+	if conf.Tick <= 0 {
+		conf.Tick = time.Second
+	}
+	if conf.RateBurst <= 0 {
+		conf.RateBurst = int(conf.Rate)
+		if conf.RateBurst < 1 {
+			conf.RateBurst = 1
+		}
+	}
+	return &Sampler{
+		conf:     conf,
+		now:      time.Now,
+		messages: map[sampleKey]int{},
+		levels:   map[zerolog.Level]int{},
+		buckets:  map[uintptr]*tokenBucket{},
+	}
+}
+
+type samplerSummaryKey struct{}
+
+// attach makes the sampler write its summaries through l, and read the time from clock if not nil.
+// A sampler shared by several loggers keeps the first one: the others share its budget, and their
+// suppressed records are summarised through the first logger.
+func (s *Sampler) attach(l *DefaultLogger, clock Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.emit != nil {
+		return
+	}
+	ctx := context.WithValue(context.Background(), samplerSummaryKey{}, true)
+	s.emit = func(suppressed int, from, to time.Time) {
+		zl := l.Unwrap()
+		zl.Warn().Ctx(ctx).
+			Int("suppressed", suppressed).
+			Time("from", from).
+			Time("to", to).
+			Msgf("sampling suppressed %d log records", suppressed)
+	}
+	if clock != nil {
+		s.now = clock.Now
+	}
+}
+
+// Run implements zerolog.Hook.
+func (s *Sampler) Run(e *zerolog.Event, level zerolog.Level, message string) {
+	if level == zerolog.Disabled || (s.conf.ExemptErrors && level >= zerolog.ErrorLevel && level != noticeLevel) {
+		return
+	}
+	if ctx := e.GetCtx(); ctx != nil && ctx.Value(samplerSummaryKey{}) != nil {
+		return
+	}
+	var pc uintptr
+	if s.conf.Rate > 0 {
+		pc = callerPC()
+	}
+	if !s.allow(level, message, pc) {
+		e.Discard()
+	}
+}
+
+func (s *Sampler) allow(level zerolog.Level, message string, pc uintptr) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.windowStart) >= s.conf.Tick {
+		s.windowStart = now
+		clear(s.messages)
+		clear(s.levels)
+	}
+
+	ok := true
+	if s.conf.Burst > 0 {
+		s.levels[level]++
+		ok = s.levels[level] <= s.conf.Burst
+	}
+	if ok && s.conf.First > 0 {
+		key := sampleKey{level: level, message: message}
+		s.messages[key]++
+		if n := s.messages[key]; n > s.conf.First {
+			ok = s.conf.Thereafter > 0 && (n-s.conf.First)%s.conf.Thereafter == 0
+		}
+	}
+	if ok && s.conf.Rate > 0 {
+		ok = s.take(pc, now)
+	}
+
+	if !ok {
+		s.suppress(now)
+	}
+	return ok
+}
+
+// take removes a token from the bucket of the caller location pc.
+func (s *Sampler) take(pc uintptr, now time.Time) bool {
+	b, found := s.buckets[pc]
+	if !found {
+		b = &tokenBucket{tokens: float64(s.conf.RateBurst), last: now}
+		s.buckets[pc] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * s.conf.Rate
+	if max := float64(s.conf.RateBurst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// suppress counts a dropped record and schedules the summary for the end of the window.
+func (s *Sampler) suppress(now time.Time) {
+	if s.suppressed == 0 {
+		s.since = now
+	}
+	s.suppressed++
+	if s.timer == nil && s.emit != nil {
+		s.timer = time.AfterFunc(s.windowStart.Add(s.conf.Tick).Sub(now), s.flush)
+	}
+}
+
+func (s *Sampler) flush() {
+	s.mu.Lock()
+	n, since, to, emit := s.suppressed, s.since, s.now(), s.emit
+	s.suppressed = 0
+	s.timer = nil
+	s.mu.Unlock()
+
+	if n > 0 {
+		emit(n, since, to)
+	}
+}
+
+var (
+	zerologPkg  = reflect.TypeOf(zerolog.Logger{}).PkgPath() + "."
+	oceanlogPkg = reflect.TypeOf(DefaultLogger{}).PkgPath() + "."
+)
+
+// callerPC returns the program counter of the first frame outside zerolog and this module.
+func callerPC() uintptr {
+	var pcs [16]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		internal := strings.HasPrefix(f.Function, zerologPkg) || internalFrame(f.Function, f.File)
+		if !internal || !more {
+			return f.PC
+		}
+	}
+}
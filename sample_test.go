@@ -0,0 +1,140 @@
+package oceanlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// syncBuffer is a bytes.Buffer safe for the sampler's summary goroutine.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) Lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Split(strings.TrimSpace(s.b.String()), "\n")
+}
+
+func newTestSampler(conf SamplingConf) *Sampler {
+	if conf.Tick == 0 {
+		conf.Tick = time.Hour
+	}
+	s := NewSampler(conf)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func TestSampler_FirstThereafter(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b), WithSampler(newTestSampler(SamplingConf{First: 2, Thereafter: 3})))
+
+	for i := 0; i < 10; i++ {
+		l.Infof("retry %d", 0)
+	}
+	l.Info("other")
+
+	assert.Len(t, b.Lines(), 5)
+}
+
+func TestSampler_Burst(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b), WithSampler(newTestSampler(SamplingConf{Burst: 3})))
+
+	for i := 0; i < 5; i++ {
+		l.Infof("info %d", i)
+		l.Warnf("warn %d", i)
+	}
+
+	assert.Len(t, b.Lines(), 6)
+}
+
+func TestSampler_ExemptErrors(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b), WithSampler(newTestSampler(SamplingConf{First: 1, ExemptErrors: true})))
+
+	for i := 0; i < 5; i++ {
+		l.Error("boom")
+		l.Info("fine")
+	}
+
+	assert.Len(t, b.Lines(), 6)
+}
+
+func TestSampler_RatePerCaller(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b), WithSampler(newTestSampler(SamplingConf{Rate: 1, RateBurst: 2})), WithoutCaller())
+
+	for i := 0; i < 5; i++ {
+		l.Info("a")
+	}
+	for i := 0; i < 5; i++ {
+		l.Info("b")
+	}
+
+	assert.Equal(t, []string{
+		`{"level":"info","message":"a"}`,
+		`{"level":"info","message":"a"}`,
+		`{"level":"info","message":"b"}`,
+		`{"level":"info","message":"b"}`,
+	}, b.Lines())
+}
+
+func TestSampler_Summary(t *testing.T) {
+	b := &syncBuffer{}
+	l := New(WithOutput(b), WithSampler(NewSampler(SamplingConf{Tick: 20 * time.Millisecond, First: 1})))
+
+	for i := 0; i < 5; i++ {
+		l.Info("hot loop")
+	}
+
+	assert.Eventually(t, func() bool { return len(b.Lines()) == 2 }, time.Second, 5*time.Millisecond)
+
+	var summary struct {
+		Level      string `json:"level"`
+		Suppressed int    `json:"suppressed"`
+		Message    string `json:"message"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(b.Lines()[1]), &summary))
+	assert.Equal(t, "warn", summary.Level)
+	assert.Equal(t, 4, summary.Suppressed)
+	assert.Equal(t, "sampling suppressed 4 log records", summary.Message)
+}
+
+func TestSampler_shared(t *testing.T) {
+	s := NewSampler(SamplingConf{Tick: 20 * time.Millisecond, First: 1})
+	b1, b2 := &syncBuffer{}, &syncBuffer{}
+	l1 := New(WithOutput(b1), WithSampler(s), WithoutCaller())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// the loggers built while the sampler is in use share it
+			New(WithOutput(b2), WithSampler(s)).Info("hot loop")
+			l1.Info("hot loop")
+		}()
+	}
+	wg.Wait()
+
+	// one record passes, the others are summarised through the first logger
+	assert.Eventually(t, func() bool {
+		return strings.Contains(strings.Join(b1.Lines(), "\n"), "sampling suppressed 7 log records")
+	}, time.Second, 5*time.Millisecond)
+	assert.NotContains(t, strings.Join(b2.Lines(), "\n"), "sampling suppressed")
+}
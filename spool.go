@@ -0,0 +1,524 @@
+package oceanlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var _ zerolog.LevelWriter = (*SpoolWriter)(nil)
+
+const (
+	spoolSegmentExt = ".seg"
+	spoolCursorFile = "cursor"
+	// payload length, crc32 of the level and payload, level
+	spoolHeader = 9
+)
+
+// SpoolConf configures a SpoolWriter.
+type SpoolConf struct {
+	Dir         string        `json:"dir"`          // segments directory, one per sink
+	SegmentSize int64         `json:"segment_size"` // 16MiB by default
+	MaxBytes    int64         `json:"max_bytes"`    // disk usage beyond which the oldest segments are evicted, 1GiB by default
+	BatchSize   int           `json:"batch_size"`   // records replayed before flushing the sink and saving the position, 1000 by default
+	MinBackoff  time.Duration `json:"min_backoff"`  // first retry delay when the sink fails, 100ms by default
+	MaxBackoff  time.Duration `json:"max_backoff"`  // 30s by default
+	Sync        bool          `json:"sync"`         // fsync every record to survive OS crashes, not only process crashes
+}
+
+// SpoolStats describes the content of a spool.
+type SpoolStats struct {
+	Segments int   // segment files
+	Bytes    int64 // size of the segment files
+	Pending  int64 // bytes not replayed yet
+	Evicted  int64 // bytes evicted since the spool was opened
+}
+
+type spoolSegment struct {
+	id   uint64
+	size int64
+}
+
+type spoolRecord struct {
+	level zerolog.Level
+	data  []byte
+}
+
+// SpoolWriter is a write-ahead spool in front of a remote sink. Records are appended to segment files
+// and replayed to the sink in order by a background goroutine, which backs off while the sink fails,
+// so a sink outage neither blocks nor loses records.
+//
+// Records count as delivered once the sink accepted them and its Flush method, if any, succeeded;
+// the replay position is then saved in the directory. Delivery is at least once: records replayed
+// but not saved yet are replayed again after a restart. When the segments exceed MaxBytes, the oldest
+// ones are evicted, delivered or not.
+type SpoolWriter struct {
+	sink io.Writer
+	conf SpoolConf
+
+	mu       sync.Mutex
+	segments []*spoolSegment // oldest first, the last one is active
+	file     *os.File        // active segment
+	readSeg  uint64          // position of the next record to replay
+	readOff  int64
+	evicted  int64
+	closed   bool
+
+	// send serializes the replays
+	send   sync.Mutex
+	notify chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewSpoolWriter opens the spool of conf.Dir, creating it if needed, and replays its records to sink.
+func NewSpoolWriter(sink io.Writer, conf SpoolConf) (*SpoolWriter, error) {
+	if conf.Dir == "" {
+		return nil, fmt.Errorf("spool: no dir")
+	}
+	if conf.SegmentSize <= 0 {
+		conf.SegmentSize = 16 << 20
+	}
+	if conf.MaxBytes <= 0 {
+		conf.MaxBytes = 1 << 30
+	}
+	if conf.SegmentSize > conf.MaxBytes/2 {
+		// leave room for a sealed segment besides the active one
+		conf.SegmentSize = conf.MaxBytes / 2
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 1000
+	}
+	if conf.MinBackoff <= 0 {
+		conf.MinBackoff = 100 * time.Millisecond
+	}
+	if conf.MaxBackoff <= 0 {
+		conf.MaxBackoff = 30 * time.Second
+	}
+	if err := os.MkdirAll(conf.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("spool: %w", err)
+	}
+
+	w := &SpoolWriter{
+		sink:   sink,
+		conf:   conf,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	w.wg.Add(1)
+	go w.run()
+	w.signal()
+	return w, nil
+}
+
+// open loads the segments and the replay position, and starts a new active segment.
+func (w *SpoolWriter) open() error {
+	entries, err := os.ReadDir(w.conf.Dir)
+	if err != nil {
+		return fmt.Errorf("spool: %w", err)
+	}
+	for _, e := range entries {
+		id, err := strconv.ParseUint(strings.TrimSuffix(e.Name(), spoolSegmentExt), 10, 64)
+		if err != nil || !strings.HasSuffix(e.Name(), spoolSegmentExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return fmt.Errorf("spool: %w", err)
+		}
+		w.segments = append(w.segments, &spoolSegment{id: id, size: info.Size()})
+	}
+	sort.Slice(w.segments, func(i, j int) bool { return w.segments[i].id < w.segments[j].id })
+
+	if b, err := os.ReadFile(filepath.Join(w.conf.Dir, spoolCursorFile)); err == nil {
+		_, _ = fmt.Sscanf(string(b), "%d %d", &w.readSeg, &w.readOff)
+	}
+	// the segments before the position were delivered
+	for len(w.segments) > 0 && w.segments[0].id < w.readSeg {
+		_ = os.Remove(w.path(w.segments[0].id))
+		w.segments = w.segments[1:]
+	}
+	if len(w.segments) == 0 || w.segments[0].id != w.readSeg {
+		// the segment of the position was delivered or evicted
+		w.readSeg, w.readOff = 0, 0
+		if len(w.segments) > 0 {
+			w.readSeg = w.segments[0].id
+		}
+	}
+	// a crash may have left a partial record at the end of the last segment: append to a new one
+	return w.rotate()
+}
+
+func (w *SpoolWriter) path(id uint64) string {
+	return filepath.Join(w.conf.Dir, fmt.Sprintf("%020d%s", id, spoolSegmentExt))
+}
+
+// rotate seals the active segment and creates the next one.
+func (w *SpoolWriter) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return fmt.Errorf("spool: %w", err)
+		}
+		w.file = nil
+	}
+	var id uint64 = 1
+	if len(w.segments) > 0 {
+		id = w.segments[len(w.segments)-1].id + 1
+	}
+	f, err := os.OpenFile(w.path(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("spool: %w", err)
+	}
+	w.file = f
+	w.segments = append(w.segments, &spoolSegment{id: id})
+	if len(w.segments) == 1 {
+		w.readSeg, w.readOff = id, 0
+	}
+	return nil
+}
+
+// Write implements io.Writer.
+func (w *SpoolWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter. It only fails when the record cannot be written to disk.
+func (w *SpoolWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	rec := make([]byte, spoolHeader+len(p))
+	binary.BigEndian.PutUint32(rec, uint32(len(p)))
+	rec[8] = byte(level)
+	copy(rec[spoolHeader:], p)
+	binary.BigEndian.PutUint32(rec[4:], crc32.ChecksumIEEE(rec[8:]))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, fmt.Errorf("spool: writer closed")
+	}
+	active := w.segments[len(w.segments)-1]
+	if active.size > 0 && active.size+int64(len(rec)) > w.conf.SegmentSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+		active = w.segments[len(w.segments)-1]
+	}
+	n, err := w.file.Write(rec)
+	active.size += int64(n)
+	if err == nil && w.conf.Sync {
+		err = w.file.Sync()
+	}
+	if err != nil {
+		if n > 0 {
+			// continue after the partial record in a new segment
+			_ = w.rotate()
+		}
+		return 0, fmt.Errorf("spool: %w", err)
+	}
+	w.evict()
+	w.signal()
+	return len(p), nil
+}
+
+// evict removes the oldest sealed segments while the spool exceeds MaxBytes.
+func (w *SpoolWriter) evict() {
+	var size int64
+	for _, s := range w.segments {
+		size += s.size
+	}
+	for size > w.conf.MaxBytes && len(w.segments) > 1 {
+		s := w.segments[0]
+		w.segments = w.segments[1:]
+		if err := os.Remove(w.path(s.id)); err != nil && !os.IsNotExist(err) {
+			log.Println(err.Error())
+		}
+		if w.readSeg == s.id {
+			log.Printf("spool: %s full, evicted %d bytes of segment %d", w.conf.Dir, s.size-w.readOff, s.id)
+			w.evicted += s.size - w.readOff
+			w.readSeg, w.readOff = w.segments[0].id, 0
+		}
+		size -= s.size
+	}
+}
+
+func (w *SpoolWriter) signal() {
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Stats returns the size of the spool.
+func (w *SpoolWriter) Stats() SpoolStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	st := SpoolStats{Segments: len(w.segments), Evicted: w.evicted}
+	for _, s := range w.segments {
+		st.Bytes += s.size
+		if s.id >= w.readSeg {
+			st.Pending += s.size
+		}
+	}
+	st.Pending -= w.readOff
+	return st
+}
+
+// Flush syncs the active segment and replays the pending records, it returns the error of the sink.
+// The records stay in the spool when the sink fails.
+func (w *SpoolWriter) Flush() error {
+	w.mu.Lock()
+	var err error
+	if w.file != nil {
+		err = w.file.Sync()
+	}
+	w.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("spool: %w", err)
+	}
+
+	w.send.Lock()
+	defer w.send.Unlock()
+	return w.replay()
+}
+
+// Close stops the replay after a last attempt and closes the sink if it is an io.Closer.
+// The records that were not delivered are replayed when the spool is opened again.
+func (w *SpoolWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.done)
+	w.wg.Wait()
+	errs := []error{w.Flush()}
+
+	w.mu.Lock()
+	errs = append(errs, w.file.Close())
+	if active := w.segments[len(w.segments)-1]; active.size == 0 {
+		_ = os.Remove(w.path(active.id))
+	}
+	w.file = nil
+	w.mu.Unlock()
+	if c, ok := w.sink.(io.Closer); ok {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (w *SpoolWriter) run() {
+	defer w.wg.Done()
+	var backoff time.Duration
+	for {
+		if backoff == 0 {
+			select {
+			case <-w.notify:
+			case <-w.done:
+				return
+			}
+		} else if !w.wait(backoff) {
+			// the sink is down: the new records wait for the next attempt
+			return
+		}
+
+		w.send.Lock()
+		err := w.replay()
+		w.send.Unlock()
+		switch {
+		case err == nil:
+			if backoff > 0 {
+				log.Printf("spool: %s replaying again", w.conf.Dir)
+			}
+			backoff = 0
+		case backoff == 0:
+			log.Printf("spool: %s sink failed, spooling: %v", w.conf.Dir, err)
+			backoff = w.conf.MinBackoff
+		default:
+			if backoff *= 2; backoff > w.conf.MaxBackoff {
+				backoff = w.conf.MaxBackoff
+			}
+		}
+	}
+}
+
+// wait sleeps for d, it returns false if the writer is closed meanwhile.
+func (w *SpoolWriter) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// replay writes the pending records to the sink in batches, saving the position after each one.
+func (w *SpoolWriter) replay() error {
+	for {
+		recs, seg, off, err := w.read()
+		if err != nil || len(recs) == 0 {
+			return err
+		}
+		for _, r := range recs {
+			if lw, ok := w.sink.(zerolog.LevelWriter); ok {
+				_, err = lw.WriteLevel(r.level, r.data)
+			} else {
+				_, err = w.sink.Write(r.data)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if f, ok := w.sink.(interface{ Flush() error }); ok {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+		if err := w.commit(seg, off); err != nil {
+			return err
+		}
+	}
+}
+
+// read returns the next batch of records and the position following it, or no records when all were
+// replayed. It skips the segments that were replayed entirely and the end of corrupt segments.
+func (w *SpoolWriter) read() (recs []spoolRecord, seg uint64, off int64, err error) {
+	for {
+		w.mu.Lock()
+		seg, off = w.readSeg, w.readOff
+		var size int64 = -1
+		active := false
+		for i, s := range w.segments {
+			if s.id == seg {
+				size, active = s.size, i == len(w.segments)-1
+			}
+		}
+		w.mu.Unlock()
+		if size < 0 {
+			return nil, 0, 0, nil
+		}
+		if off >= size {
+			if active {
+				return nil, seg, off, nil
+			}
+			// the sealed segment was replayed
+			if err := w.next(seg); err != nil {
+				return nil, 0, 0, err
+			}
+			continue
+		}
+
+		recs, end, err := w.readSegment(seg, off, size)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if len(recs) > 0 {
+			return recs, seg, end, nil
+		}
+		if end < size {
+			log.Printf("spool: %s corrupt record in segment %d at %d, skipping %d bytes", w.conf.Dir, seg, off, size-off)
+		}
+		if err := w.commit(seg, size); err != nil {
+			return nil, 0, 0, err
+		}
+		if active {
+			return nil, seg, size, nil
+		}
+	}
+}
+
+// readSegment reads at most BatchSize records of seg between off and size. It stops at the first corrupt record.
+func (w *SpoolWriter) readSegment(seg uint64, off, size int64) ([]spoolRecord, int64, error) {
+	f, err := os.Open(w.path(seg))
+	if os.IsNotExist(err) {
+		// evicted meanwhile
+		return nil, size, nil
+	} else if err != nil {
+		return nil, off, fmt.Errorf("spool: %w", err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(io.NewSectionReader(f, off, size-off))
+
+	var recs []spoolRecord
+	var header [spoolHeader]byte
+	for len(recs) < w.conf.BatchSize && off < size {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			break
+		}
+		n := int64(binary.BigEndian.Uint32(header[:]))
+		if off+spoolHeader+n > size {
+			break
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r, data); err != nil {
+			break
+		}
+		crc := crc32.Update(crc32.ChecksumIEEE(header[8:]), crc32.IEEETable, data)
+		if crc != binary.BigEndian.Uint32(header[4:]) {
+			break
+		}
+		recs = append(recs, spoolRecord{level: zerolog.Level(int8(header[8])), data: data})
+		off += spoolHeader + n
+	}
+	return recs, off, nil
+}
+
+// commit saves the position off of seg, unless the segment was evicted meanwhile.
+func (w *SpoolWriter) commit(seg uint64, off int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if seg != w.readSeg {
+		return nil
+	}
+	w.readOff = off
+	return w.saveCursor()
+}
+
+// next removes the replayed segment seg and moves the position to the following one.
+func (w *SpoolWriter) next(seg uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if seg != w.readSeg || len(w.segments) < 2 || w.segments[0].id != seg {
+		return nil
+	}
+	w.segments = w.segments[1:]
+	w.readSeg, w.readOff = w.segments[0].id, 0
+	if err := w.saveCursor(); err != nil {
+		return err
+	}
+	if err := os.Remove(w.path(seg)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("spool: %w", err)
+	}
+	return nil
+}
+
+// saveCursor atomically writes the position.
+func (w *SpoolWriter) saveCursor() error {
+	name := filepath.Join(w.conf.Dir, spoolCursorFile)
+	if err := os.WriteFile(name+".tmp", []byte(fmt.Sprintf("%d %d\n", w.readSeg, w.readOff)), 0o644); err != nil {
+		return fmt.Errorf("spool: %w", err)
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return fmt.Errorf("spool: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package oceanlog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakySink records the records it is written, it fails while down.
+type flakySink struct {
+	mu      sync.Mutex
+	down    bool
+	records []string
+	levels  []zerolog.Level
+	closed  bool
+}
+
+func (s *flakySink) Write(p []byte) (int, error) {
+	return s.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (s *flakySink) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		return 0, errors.New("sink down")
+	}
+	s.records = append(s.records, strings.TrimSuffix(string(p), "\n"))
+	s.levels = append(s.levels, level)
+	return len(p), nil
+}
+
+func (s *flakySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *flakySink) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func (s *flakySink) written() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.records...)
+}
+
+func writeRecords(t *testing.T, w *SpoolWriter, from, to int) {
+	for i := from; i < to; i++ {
+		_, err := w.WriteLevel(zerolog.InfoLevel, []byte(fmt.Sprintf("record %d\n", i)))
+		assert.NoError(t, err)
+	}
+}
+
+func records(from, to int) []string {
+	var recs []string
+	for i := from; i < to; i++ {
+		recs = append(recs, fmt.Sprintf("record %d", i))
+	}
+	return recs
+}
+
+func TestSpoolWriter(t *testing.T) {
+	sink := &flakySink{}
+	w, err := NewSpoolWriter(sink, SpoolConf{Dir: t.TempDir(), BatchSize: 3})
+	assert.NoError(t, err)
+
+	writeRecords(t, w, 0, 10)
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, records(0, 10), sink.written())
+	assert.Equal(t, zerolog.InfoLevel, sink.levels[0])
+	assert.Equal(t, int64(0), w.Stats().Pending)
+
+	// the records are replayed in the background as well
+	writeRecords(t, w, 10, 12)
+	assert.Eventually(t, func() bool { return len(sink.written()) == 12 }, time.Second, time.Millisecond)
+	assert.NoError(t, w.Close())
+	assert.True(t, sink.closed)
+}
+
+func TestSpoolWriter_outage(t *testing.T) {
+	sink := &flakySink{down: true}
+	w, err := NewSpoolWriter(sink, SpoolConf{Dir: t.TempDir(), MinBackoff: time.Millisecond,
+		MaxBackoff: 10 * time.Millisecond})
+	assert.NoError(t, err)
+	defer w.Close()
+
+	writeRecords(t, w, 0, 5)
+	assert.EqualError(t, w.Flush(), "sink down")
+	assert.Equal(t, int64(5*(spoolHeader+9)), w.Stats().Pending)
+
+	// the records are replayed in order once the sink recovers
+	sink.setDown(false)
+	assert.Eventually(t, func() bool { return len(sink.written()) == 5 }, time.Second, time.Millisecond)
+	assert.Equal(t, records(0, 5), sink.written())
+}
+
+func TestSpoolWriter_restart(t *testing.T) {
+	dir := t.TempDir()
+	sink := &flakySink{down: true}
+	w, err := NewSpoolWriter(sink, SpoolConf{Dir: dir, SegmentSize: 64})
+	assert.NoError(t, err)
+	writeRecords(t, w, 0, 10)
+	assert.Error(t, w.Close())
+
+	// the spooled records survive the restart
+	sink = &flakySink{}
+	w, err = NewSpoolWriter(sink, SpoolConf{Dir: dir, SegmentSize: 64})
+	assert.NoError(t, err)
+	writeRecords(t, w, 10, 12)
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, records(0, 12), sink.written())
+	assert.NoError(t, w.Close())
+
+	// and are not replayed again
+	sink = &flakySink{}
+	w, err = NewSpoolWriter(sink, SpoolConf{Dir: dir, SegmentSize: 64})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Flush())
+	assert.Empty(t, sink.written())
+	assert.Equal(t, 1, w.Stats().Segments)
+	assert.NoError(t, w.Close())
+}
+
+func TestSpoolWriter_evict(t *testing.T) {
+	sink := &flakySink{down: true}
+	// 18 bytes per record, 3 records per segment
+	w, err := NewSpoolWriter(sink, SpoolConf{Dir: t.TempDir(), SegmentSize: 54, MaxBytes: 120})
+	assert.NoError(t, err)
+	defer w.Close()
+
+	writeRecords(t, w, 0, 10)
+	st := w.Stats()
+	assert.LessOrEqual(t, st.Bytes, int64(120))
+	assert.Equal(t, int64(6*18), st.Evicted)
+
+	// the oldest records were evicted
+	sink.setDown(false)
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, records(6, 10), sink.written())
+}
+
+func TestSpoolWriter_corrupt(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewSpoolWriter(&flakySink{down: true}, SpoolConf{Dir: dir})
+	assert.NoError(t, err)
+	writeRecords(t, w, 0, 3)
+	assert.Error(t, w.Close())
+
+	// a crash left a partial record
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+	f, err := os.OpenFile(segments[0], os.O_APPEND|os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, _ = f.Write([]byte{0, 0, 0, 9, 1, 2})
+	assert.NoError(t, f.Close())
+
+	sink := &flakySink{}
+	w, err = NewSpoolWriter(sink, SpoolConf{Dir: dir})
+	assert.NoError(t, err)
+	defer w.Close()
+	writeRecords(t, w, 3, 4)
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, records(0, 4), sink.written())
+}
+
+func TestSpoolWriter_conf(t *testing.T) {
+	_, err := NewSpoolWriter(&flakySink{}, SpoolConf{})
+	assert.EqualError(t, err, "spool: no dir")
+}
+
+func TestLogConf_spool(t *testing.T) {
+	es := newFakeCluster(t)
+	dir := t.TempDir()
+	c := NewDefaultLogger(filepath.Join(dir, "app.log"), "info", WithSpool(SpoolConf{}),
+		WithElasticsearch(ElasticsearchConf{URL: es.URL, MaxRetries: 1, MinBackoff: time.Millisecond}))
+	c.Stdout, c.Fileout = false, false
+	l := c.GetOceanLog()
+
+	es.status.Store(503)
+	es.failures.Store(1 << 20)
+	l.Info("spooled")
+	assert.Error(t, l.Flush())
+	assert.Empty(t, es.documents())
+
+	// the record failed by Elasticsearch is replayed by the spool
+	es.failures.Store(0)
+	assert.NoError(t, l.Flush())
+	if docs := es.documents(); assert.Len(t, docs, 1) {
+		assert.Equal(t, "spooled", docs[0].doc["message"])
+	}
+	assert.DirExists(t, filepath.Join(dir, "spool", "elasticsearch"))
+}
+
+func TestLogConf_spoolShared(t *testing.T) {
+	es := newFakeCluster(t)
+	c := NewDefaultLogger(filepath.Join(t.TempDir(), "app.log"), "info", WithSpool(SpoolConf{}),
+		WithElasticsearch(ElasticsearchConf{URL: es.URL}))
+	c.Stdout, c.Fileout = false, false
+
+	// the loggers of c share one spool of the directory
+	l1, l2 := c.GetOceanLog(), c.GetOceanLog()
+	l1.Info("first")
+	l2.Info("second")
+	assert.NoError(t, l1.Flush())
+	assert.NoError(t, l2.Flush())
+
+	var messages []string
+	for _, doc := range es.documents() {
+		messages = append(messages, doc.doc["message"].(string))
+	}
+	assert.ElementsMatch(t, []string{"first", "second"}, messages)
+}
+
+func TestLogConf_outputsConcurrent(t *testing.T) {
+	// a LogConf not built by NewDefaultLogger gets its registry with the first logger
+	c := &LogConf{Level: "info", Journald: &JournaldConf{Socket: filepath.Join(t.TempDir(), "none"), Fallback: io.Discard}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.GetOceanLog().Info("started")
+			_ = c.Health()
+		}()
+	}
+	wg.Wait()
+	if health := c.Health(); assert.Len(t, health, 1) {
+		assert.Equal(t, "journald", health[0].Name)
+	}
+}
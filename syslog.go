@@ -0,0 +1,377 @@
+package oceanlog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var _ zerolog.LevelWriter = (*SyslogWriter)(nil)
+
+// Syslog message formats.
+const (
+	SyslogRFC5424 = "rfc5424"
+	SyslogRFC3164 = "rfc3164"
+)
+
+// Syslog framings of stream transports.
+const (
+	// SyslogOctetCounting prefixes each message with its length, RFC 6587.
+	SyslogOctetCounting = "octet-counting"
+	// SyslogNonTransparent terminates each message with a newline.
+	SyslogNonTransparent = "non-transparent"
+)
+
+// DefaultSyslogSDID is the structured data ID of the record fields.
+const DefaultSyslogSDID = "fields@32473"
+
+// SyslogConf configures a SyslogWriter.
+type SyslogConf struct {
+	// Network is "udp", "tcp", "unix" or "unixgram". Empty, the local syslog socket is used.
+	Network string `json:"network"`
+	// Addr is the host:port or the socket path, e.g. "/dev/log".
+	Addr string `json:"addr"`
+	// Format is SyslogRFC5424, the default, or SyslogRFC3164.
+	Format string `json:"format"`
+	// Framing of the tcp and unix transports, SyslogOctetCounting by default.
+	Framing string `json:"framing"`
+	// Facility is a facility name such as "local0", "user" by default.
+	Facility string `json:"facility"`
+	// AppName defaults to the program name.
+	AppName string `json:"app_name"`
+	// Hostname defaults to os.Hostname.
+	Hostname string `json:"hostname"`
+	// SDID is the structured data ID of the fields, DefaultSyslogSDID by default.
+	SDID string `json:"sd_id"`
+	// MinBackoff is the delay before dialing again after a failed dial, 100ms by default.
+	// It doubles on each failure up to MaxBackoff, 10s by default.
+	MinBackoff time.Duration `json:"min_backoff"`
+	MaxBackoff time.Duration `json:"max_backoff"`
+	// Timeout of the dial and of the writes, 5s by default.
+	Timeout time.Duration `json:"timeout"`
+}
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogSeverities maps the record levels to syslog severities.
+var syslogSeverities = map[string]int{
+	"panic":          1, // alert
+	"fatal":          2, // crit
+	"error":          3, // err
+	"warn":           4, // warning
+	LevelNoticeValue: 5, // notice
+	"info":           6, // info
+	"debug":          7, // debug
+	"trace":          7, // debug
+}
+
+// SyslogWriter writes JSON records as syslog messages, carrying the fields as RFC 5424 structured data.
+// It connects on the first write. A failed write reconnects and retries once; after a failed dial,
+// writes fail without dialing until the backoff is over.
+type SyslogWriter struct {
+	conf     SyslogConf
+	facility int
+	pid      string
+
+	mu     sync.Mutex
+	now    func() time.Time
+	conn   net.Conn
+	stream bool
+	closed bool
+	// dialing is set while a write dials outside mu, the other writes fail meanwhile
+	dialing bool
+	dialErr error
+	backoff time.Duration
+	retry   time.Time
+}
+
+// NewSyslogWriter returns a writer sending to the syslog server of conf. It connects on the first write.
+func NewSyslogWriter(conf SyslogConf) (*SyslogWriter, error) {
+	if conf.Format == "" {
+		conf.Format = SyslogRFC5424
+	}
+	if conf.Format != SyslogRFC5424 && conf.Format != SyslogRFC3164 {
+		return nil, fmt.Errorf("syslog: unknown format %q", conf.Format)
+	}
+	if conf.Framing == "" {
+		conf.Framing = SyslogOctetCounting
+	}
+	if conf.Facility == "" {
+		conf.Facility = "user"
+	}
+	facility, ok := syslogFacilities[conf.Facility]
+	if !ok {
+		return nil, fmt.Errorf("syslog: unknown facility %q", conf.Facility)
+	}
+	if conf.AppName == "" {
+		conf.AppName = basename(os.Args[0])
+	}
+	if conf.Hostname == "" {
+		conf.Hostname, _ = os.Hostname()
+	}
+	if conf.SDID == "" {
+		conf.SDID = DefaultSyslogSDID
+	}
+	if conf.MinBackoff <= 0 {
+		conf.MinBackoff = 100 * time.Millisecond
+	}
+	if conf.MaxBackoff <= 0 {
+		conf.MaxBackoff = 10 * time.Second
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 5 * time.Second
+	}
+
+	return &SyslogWriter{
+		conf:     conf,
+		facility: facility,
+		pid:      strconv.Itoa(os.Getpid()),
+		now:      time.Now,
+	}, nil
+}
+
+// SetClock sets the clock of the message timestamps. By default, it is SystemClock.
+func (w *SyslogWriter) SetClock(c Clock) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.now = c.Now
+}
+
+// connection returns the current connection or dials one. The dial runs outside mu, so that a server
+// that does not answer blocks one write only.
+func (w *SyslogWriter) connection() (net.Conn, bool, error) {
+	w.mu.Lock()
+	switch {
+	case w.closed:
+		w.mu.Unlock()
+		return nil, false, errors.New("syslog: writer closed")
+	case w.conn != nil:
+		defer w.mu.Unlock()
+		return w.conn, w.stream, nil
+	case w.dialing:
+		w.mu.Unlock()
+		return nil, false, errors.New("syslog: connecting")
+	case time.Now().Before(w.retry):
+		defer w.mu.Unlock()
+		return nil, false, fmt.Errorf("syslog: reconnecting: %w", w.dialErr)
+	}
+	w.dialing = true
+	w.mu.Unlock()
+
+	conn, stream, err := w.dial()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.dialing = false
+	if err != nil {
+		if w.backoff < w.conf.MinBackoff {
+			w.backoff = w.conf.MinBackoff
+		} else if w.backoff *= 2; w.backoff > w.conf.MaxBackoff {
+			w.backoff = w.conf.MaxBackoff
+		}
+		w.dialErr, w.retry = err, time.Now().Add(w.backoff)
+		return nil, false, err
+	}
+	if w.closed {
+		_ = conn.Close()
+		return nil, false, errors.New("syslog: writer closed")
+	}
+	w.conn, w.stream, w.backoff = conn, stream, 0
+	return conn, stream, nil
+}
+
+// disconnect closes conn after a failed write, unless another write replaced it already.
+func (w *SyslogWriter) disconnect(conn net.Conn) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == conn {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+}
+
+// dial connects to the server, trying the usual local sockets when no network is configured.
+// It reports whether the connection is a stream.
+func (w *SyslogWriter) dial() (net.Conn, bool, error) {
+	if w.conf.Network != "" {
+		conn, err := net.DialTimeout(w.conf.Network, w.conf.Addr, w.conf.Timeout)
+		if err != nil {
+			return nil, false, err
+		}
+		stream := w.conf.Network != "udp" && w.conf.Network != "udp4" && w.conf.Network != "udp6" &&
+			w.conf.Network != "unixgram"
+		return conn, stream, nil
+	}
+
+	addrs := []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+	if w.conf.Addr != "" {
+		addrs = []string{w.conf.Addr}
+	}
+	var errs []error
+	for _, addr := range addrs {
+		for _, network := range []string{"unixgram", "unix"} {
+			conn, err := net.DialTimeout(network, addr, w.conf.Timeout)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			return conn, network == "unix", nil
+		}
+	}
+	return nil, false, fmt.Errorf("syslog: no local syslog socket: %w", errors.Join(errs...))
+}
+
+// Write implements io.Writer.
+func (w *SyslogWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (w *SyslogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	r := parseRecord(p, level)
+	w.mu.Lock()
+	t := r.timeOr(w.now)
+	w.mu.Unlock()
+	msg := w.format(r, t)
+
+	for retry := false; ; retry = true {
+		conn, stream, err := w.connection()
+		if err != nil {
+			return 0, err
+		}
+		framed := msg
+		if stream {
+			framed = w.frame(msg)
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(w.conf.Timeout))
+		if _, err = conn.Write(framed); err == nil {
+			return len(p), nil
+		}
+		w.disconnect(conn)
+		if retry {
+			return 0, err
+		}
+	}
+}
+
+// Close closes the connection.
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *SyslogWriter) frame(msg []byte) []byte {
+	if w.conf.Framing == SyslogNonTransparent {
+		return append(msg, '\n')
+	}
+	return append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+}
+
+// format returns the syslog message of r.
+func (w *SyslogWriter) format(r record, t time.Time) []byte {
+	severity, ok := syslogSeverities[r.level]
+	if !ok {
+		severity = syslogSeverities["info"]
+	}
+	pri := w.facility*8 + severity
+
+	var b bytes.Buffer
+	if w.conf.Format == SyslogRFC3164 {
+		// <PRI>Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG key=value...
+		fmt.Fprintf(&b, "<%d>%s %s %s[%s]: %s", pri, t.Format(time.Stamp), nilValue(w.conf.Hostname),
+			w.conf.AppName, w.pid, r.message)
+		for _, f := range r.fields {
+			fmt.Fprintf(&b, " %s=%s", f.key, f.String())
+		}
+		return b.Bytes()
+	}
+
+	// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s - ", pri, t.Format("2006-01-02T15:04:05.000000Z07:00"),
+		header(w.conf.Hostname, 255), header(w.conf.AppName, 48), w.pid)
+	if len(r.fields) == 0 {
+		b.WriteString("-")
+	} else {
+		b.WriteString("[")
+		b.WriteString(w.conf.SDID)
+		for _, f := range r.fields {
+			b.WriteString(" ")
+			b.WriteString(sdName(f.key))
+			b.WriteString(`="`)
+			sdEscape(&b, f.String())
+			b.WriteString(`"`)
+		}
+		b.WriteString("]")
+	}
+	if r.message != "" {
+		b.WriteString(" ")
+		b.WriteString(r.message)
+	}
+	return b.Bytes()
+}
+
+func nilValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// header returns s as an RFC 5424 header field: printable US-ASCII without spaces, at most n bytes.
+func header(s string, n int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(s) > n {
+		s = s[:n]
+	}
+	return nilValue(s)
+}
+
+// sdName returns key as an SD-NAME: printable US-ASCII except '=', ' ', ']' and '"', at most 32 bytes.
+func sdName(key string) string {
+	key = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+	if len(key) > 32 {
+		key = key[:32]
+	}
+	return nilValue(key)
+}
+
+// sdEscape writes s as a PARAM-VALUE, escaping '"', '\' and ']'.
+func sdEscape(b *bytes.Buffer, s string) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\\', ']':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+}
@@ -0,0 +1,171 @@
+package oceanlog
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var syslogTime = fixedClock(time.Date(2024, 5, 6, 7, 8, 9, 123456000, time.UTC))
+
+func readPacket(t *testing.T, conn net.PacketConn) string {
+	buf := make([]byte, 4096)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestSyslogWriter_udp(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	w, err := NewSyslogWriter(SyslogConf{Network: "udp", Addr: conn.LocalAddr().String(),
+		Facility: "local0", AppName: "app", Hostname: "host"})
+	assert.NoError(t, err)
+	defer w.Close()
+	w.SetClock(syslogTime)
+	l := New(WithOutput(w), WithoutCaller()).WithField("user", "alice")
+	pid := strconv.Itoa(os.Getpid())
+
+	l.Notice("slow")
+	assert.Equal(t, `<133>1 2024-05-06T07:08:09.123456Z host app `+pid+` - [fields@32473 user="alice"] slow`,
+		readPacket(t, conn))
+
+	l.CtxErrorw(ContextWithRequestID(context.Background(), "r]1"), nil, `quote " and \`)
+	assert.Equal(t, `<131>1 2024-05-06T07:08:09.123456Z host app `+pid+` - [fields@32473 user="alice" request_id="r\]1"] quote " and \`,
+		readPacket(t, conn))
+
+	_, _ = w.Write([]byte("plain text\n"))
+	assert.Equal(t, `<134>1 2024-05-06T07:08:09.123456Z host app `+pid+` - - plain text`, readPacket(t, conn))
+}
+
+func TestSyslogWriter_tcp(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	msgs := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			// read one octet-counted message per connection, then drop the connection
+			r := bufio.NewReader(conn)
+			size, err := r.ReadString(' ')
+			if err == nil {
+				n, _ := strconv.Atoi(strings.TrimSpace(size))
+				buf := make([]byte, n)
+				if _, err := io.ReadFull(r, buf); err == nil {
+					msgs <- string(buf)
+				}
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	w, err := NewSyslogWriter(SyslogConf{Network: "tcp", Addr: ln.Addr().String(), AppName: "app", Hostname: "host"})
+	assert.NoError(t, err)
+	defer w.Close()
+	l := New(WithOutput(w), WithoutCaller())
+
+	l.Info("first")
+	assert.True(t, strings.HasSuffix(<-msgs, " - - first"))
+
+	// the server dropped the connection, the writer reconnects
+	assert.Eventually(t, func() bool {
+		l.Info("second")
+		select {
+		case msg := <-msgs:
+			return strings.HasSuffix(msg, " second")
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}, 2*time.Second, time.Millisecond)
+}
+
+func TestSyslogWriter_serverDown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().String()
+	assert.NoError(t, ln.Close())
+
+	// the server is down at startup
+	w, err := NewSyslogWriter(SyslogConf{Network: "tcp", Addr: addr, MinBackoff: 20 * time.Millisecond})
+	assert.NoError(t, err)
+	defer w.Close()
+	_, err = w.Write([]byte(`{"message":"lost"}`))
+	assert.Error(t, err)
+	// the backoff is not over, the write does not dial
+	_, err = w.Write([]byte(`{"message":"lost"}`))
+	assert.ErrorContains(t, err, "syslog: reconnecting")
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip("address reused:", err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString(']')
+		received <- line
+	}()
+	assert.Eventually(t, func() bool {
+		_, err := w.Write([]byte(`{"message":"delivered","k":"v"}`))
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Contains(t, <-received, `k="v"]`)
+}
+
+func TestSyslogWriter_unixgram3164(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenPacket("unixgram", path)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	w, err := NewSyslogWriter(SyslogConf{Addr: path, Format: SyslogRFC3164, Facility: "daemon",
+		AppName: "app", Hostname: "host"})
+	assert.NoError(t, err)
+	defer w.Close()
+	w.SetClock(syslogTime)
+
+	New(WithOutput(w), WithoutCaller()).Warnf("disk %d%%", 91)
+	assert.Equal(t, "<28>May  6 07:08:09 host app["+strconv.Itoa(os.Getpid())+"]: disk 91%", readPacket(t, conn))
+}
+
+func TestSyslogWriter_conf(t *testing.T) {
+	_, err := NewSyslogWriter(SyslogConf{Network: "udp", Addr: "127.0.0.1:514", Facility: "nope"})
+	assert.EqualError(t, err, `syslog: unknown facility "nope"`)
+
+	_, err = NewSyslogWriter(SyslogConf{Network: "udp", Addr: "127.0.0.1:514", Format: "rfc9999"})
+	assert.EqualError(t, err, `syslog: unknown format "rfc9999"`)
+}
+
+func TestLogConf_syslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	c := NewDefaultLogger("", "info", WithSyslog(SyslogConf{Network: "udp", Addr: conn.LocalAddr().String()}))
+	c.Stdout, c.Fileout = false, false
+	c.GetOceanLog().Info("via conf")
+
+	assert.True(t, strings.HasSuffix(readPacket(t, conn), " via conf"))
+}